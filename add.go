@@ -0,0 +1,124 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	files "github.com/ipfs/go-ipfs/source/go-ipfs-files"
+)
+
+type object struct {
+	Hash string
+}
+
+type AddOpts = func(*RequestBuilder) error
+
+// Hash sets the hash function used to add content, e.g. "sha3-256".
+func Hash(hash string) AddOpts {
+	return func(rb *RequestBuilder) error {
+		if hash == "" {
+			return errors.New("no hash function given")
+		}
+		rb.Option("hash", hash)
+		return nil
+	}
+}
+
+// CidVersion sets the CID version, 0 or 1, of the added content.
+func CidVersion(version int) AddOpts {
+	return func(rb *RequestBuilder) error {
+		if version != 0 && version != 1 {
+			return fmt.Errorf("invalid cid version %d", version)
+		}
+		rb.Option("cid-version", version)
+		return nil
+	}
+}
+
+// OnlyHash computes the hash of the content without storing it.
+func OnlyHash(enabled bool) AddOpts {
+	return func(rb *RequestBuilder) error {
+		rb.Option("only-hash", enabled)
+		return nil
+	}
+}
+
+// Pin sets whether added content is pinned; it is by default.
+func Pin(enabled bool) AddOpts {
+	return func(rb *RequestBuilder) error {
+		rb.Option("pin", enabled)
+		return nil
+	}
+}
+
+// RawLeaves stores the leaves of the added content as raw blocks.
+func RawLeaves(enabled bool) AddOpts {
+	return func(rb *RequestBuilder) error {
+		rb.Option("raw-leaves", enabled)
+		return nil
+	}
+}
+
+// Add adds a file to ipfs and returns its hash.
+func (s *Shell) Add(r io.Reader, options ...AddOpts) (string, error) {
+	fr := files.NewReaderFile(r)
+	slf := files.NewSliceDirectory([]files.DirEntry{files.FileEntry("", fr)})
+	fileReader := files.NewMultiFileReader(slf, true)
+
+	var out object
+	rb := s.Request("add")
+	for _, option := range options {
+		if err := option(rb); err != nil {
+			return "", err
+		}
+	}
+	return out.Hash, rb.Body(fileReader).Exec(context.Background(), &out)
+}
+
+// AddNoPin adds a file to ipfs without pinning it.
+//
+// Deprecated: Use Add() with option functions instead
+func (s *Shell) AddNoPin(r io.Reader) (string, error) {
+	return s.Add(r, Pin(false))
+}
+
+// AddDir adds a directory recursively with all of the files under it and
+// returns the hash of the directory.
+func (s *Shell) AddDir(dir string, options ...AddOpts) (string, error) {
+	stat, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+
+	sf, err := files.NewSerialFile(dir, false, stat)
+	if err != nil {
+		return "", err
+	}
+	slf := files.NewSliceDirectory([]files.DirEntry{files.FileEntry(filepath.Base(dir), sf)})
+	reader := files.NewMultiFileReader(slf, true)
+
+	rb := s.Request("add").Option("recursive", true)
+	for _, option := range options {
+		if err := option(rb); err != nil {
+			return "", err
+		}
+	}
+	// the directory itself is reported last
+	var out object
+	var final string
+	err = rb.Body(reader).DecodeStream(context.Background(), &out, func() error {
+		final = out.Hash
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if final == "" {
+		return "", errors.New("no results received")
+	}
+	return final, nil
+}
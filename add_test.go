@@ -0,0 +1,105 @@
+package shell
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/cheekybits/is"
+	"github.com/xcshuan/go-mefs-api/internal/fakedaemon"
+)
+
+func TestAddOptions(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	var query map[string][]string
+	var body string
+	d.Handle("add", func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		mr, err := r.MultipartReader()
+		if err != nil {
+			fakedaemon.Error(w, err.Error())
+			return
+		}
+		part, err := mr.NextPart()
+		if err != nil {
+			fakedaemon.Error(w, err.Error())
+			return
+		}
+		data, _ := ioutil.ReadAll(part)
+		body = string(data)
+		fakedaemon.JSON(w, object{Hash: "QmAdded"})
+	})
+
+	h, err := s.Add(bytes.NewBufferString("hello"), CidVersion(1), Hash("sha3-256"), Pin(false))
+	is.NoErr(err)
+	is.Equal(h, "QmAdded")
+	is.Equal(body, "hello")
+	is.Equal(query["cid-version"], []string{"1"})
+	is.Equal(query["hash"], []string{"sha3-256"})
+	is.Equal(query["pin"], []string{"false"})
+
+	_, err = s.Add(bytes.NewBufferString("hello"), CidVersion(2))
+	is.Err(err)
+}
+
+func TestAddDirFake(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	var names []string
+	d.Handle("add", func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.URL.Query().Get("recursive"), "true")
+		mr, err := r.MultipartReader()
+		if err != nil {
+			fakedaemon.Error(w, err.Error())
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			names = append(names, part.FileName())
+		}
+		enc := json.NewEncoder(w)
+		for _, name := range names {
+			enc.Encode(object{Hash: "Qm" + name})
+		}
+	})
+
+	h, err := s.AddDir("./testdata")
+	is.NoErr(err)
+	is.Equal(len(names), 8)
+	is.Equal(h, "Qm"+names[len(names)-1])
+}
+
+func TestPinsFake(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	pins := map[string]PinInfo{}
+	d.Handle("pin/ls", func(w http.ResponseWriter, r *http.Request) {
+		fakedaemon.JSON(w, map[string]interface{}{"Keys": pins})
+	})
+	d.Handle("pin/add", func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.URL.Query().Get("recursive"), "true")
+		pins[r.URL.Query().Get("arg")] = PinInfo{Type: RecursivePin}
+		fakedaemon.JSON(w, map[string]interface{}{})
+	})
+
+	is.NoErr(s.Pin("QmA"))
+	got, err := s.Pins()
+	is.NoErr(err)
+	is.Equal(got["QmA"].Type, RecursivePin)
+}
@@ -1,27 +1,23 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"crypto/ecdsa"
-	"crypto/md5"
-	"encoding/hex"
 	"fmt"
-	"io"
+	"io/ioutil"
 	"log"
 	"math/big"
 	"math/rand"
 	"os"
-	"path"
+	"path/filepath"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/ipfs/go-ipfs/data-format"
 	"github.com/xcshuan/go-mefs-api"
 )
 
@@ -40,10 +36,17 @@ const ObjectCount = 2
 const RandomDataSize = 1024 * 1024 * 100
 const BucketName = "Bucket01"
 
-//这里填的参数按照纠删码填，多副本会自动转换
+//纠删码的数据块与校验块数目
 const DataCount = 3
 const ParityCount = 2
 
+//多副本的副本数
+const Copies = DataCount + ParityCount
+
+//上传与下载的总带宽限制(字节/秒),0表示不限制
+const UploadBandwidth = 20 * 1024 * 1024
+const DownloadBandwidth = 20 * 1024 * 1024
+
 //测试下载的输出路径
 var outPath string = os.Getenv("GOPATH")
 
@@ -53,18 +56,55 @@ var IsTest = false
 //上传下载间隔
 var sleepInterval = 10 * time.Second
 
-//用于通知结束与否
-var finishChan chan struct{}
+//同时进行的传输总数与每个User的传输数
+const Parallelism = 4
+const UserParallelism = 2
+
+//传输失败后的重试次数
+const MaxRetries = 2
 
 func main() {
 	var err error
 	rand.Seed(time.Now().Unix())
 	fmt.Println("  Begin to test upload and download...")
-	var UploadSuccess, Uploadfailed, DownloadSuccess, Downloadfailed int
-	var UploadSize int64
 	sh = shell.NewShell(endPoint)
+	//限制所有User共享的带宽,避免并发的上传下载占满链路
+	err = sh.SetLimits(shell.Limits{
+		UploadBytesPerSecond:   UploadBandwidth,
+		DownloadBytesPerSecond: DownloadBandwidth,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	//随机文件先写到临时目录,由TransferManager上传
+	tmpDir, err := ioutil.TempDir("", "benchMefs")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr, err := sh.NewTransferManager(shell.TransferConfig{
+		Parallelism:     Parallelism,
+		UserParallelism: UserParallelism,
+		MaxRetries:      MaxRetries,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	mgr.OnFinish = func(j shell.TransferJob) {
+		if j.State == shell.JobFailed {
+			fmt.Println(" ", j.Kind, j.Object, "failed after", j.Attempts, "attempts, addr", j.Address, "err", j.Err)
+			return
+		}
+		speed := float64(j.Bytes) / 1024.0 / j.Finished.Sub(j.Started).Seconds()
+		fmt.Println(" ", j.Kind, j.Object, "Size is", toStorageSize(j.Bytes), "speed is", speed, "KB/s", "addr", j.Address)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go mgr.Run(ctx)
+
 	Users := make([]*shell.UserPrivMessage, UserCount)
-	finishChan = make(chan struct{}, UserCount)
 	//首先创建指定数量的User
 	for i := 0; i < UserCount; i++ {
 		Users[i], err = sh.CreateUser()
@@ -79,10 +119,15 @@ func main() {
 	}
 
 	fmt.Println("Waiting for user start...")
+	var mu sync.Mutex
+	var uploads []shell.TransferJob
+	var wg sync.WaitGroup
 	for i := 0; i < UserCount; i++ {
 		addr := Users[i].Address
 		flag := i
+		wg.Add(1)
 		go func() {
+			defer wg.Done()
 			if !IsTest {
 				for {
 					balance := queryBalance(addr)
@@ -93,7 +138,7 @@ func main() {
 					time.Sleep(10 * time.Second)
 				}
 			}
-			err = sh.StartUser(addr)
+			err := sh.StartUser(addr)
 			if err != nil {
 				log.Println("Start User failed", err)
 			}
@@ -109,12 +154,10 @@ func main() {
 				var opts []func(*shell.RequestBuilder) error
 				//设置某些选项
 				opts = append(opts, shell.SetAddress(addr))
-				opts = append(opts, shell.SetDataCount(DataCount))
-				opts = append(opts, shell.SetParityCount(ParityCount))
 				if flag%2 == 0 {
-					opts = append(opts, shell.SetPolicy(dataformat.RsPolicy))
+					opts = append(opts, shell.SetBucketPolicy(shell.ErasureCode{Data: DataCount, Parity: ParityCount}))
 				} else {
-					opts = append(opts, shell.SetPolicy(dataformat.MulPolicy))
+					opts = append(opts, shell.SetBucketPolicy(shell.Replication{Copies: Copies}))
 				}
 				//创建一个Bucket
 				bk, err := sh.CreateBucket(BucketName, opts...)
@@ -128,120 +171,84 @@ func main() {
 				break
 			}
 
-			//然后开始上传文件
+			//然后构造随机文件并加入上传队列
 			for j := 0; j < ObjectCount; j++ {
-				//构造随机文件
 				r := rand.Int63n(RandomDataSize)
-				UploadSize += r
 				data := make([]byte, r)
 				fillRandom(data)
-				buf := bytes.NewBuffer(data)
-				objectName := addr + "_" + strconv.Itoa(int(r))
-				fmt.Println("  Begin to upload the ", j, "st", objectName, "Size is", toStorageSize(r), "addr", addr)
-				beginTime := time.Now().Unix()
-
-				//开始上传
-				ob, err := sh.PutObject(buf, objectName, BucketName, shell.SetAddress(addr))
-				if err != nil || ob == nil {
-					log.Println(addr, "Upload", objectName, "filed", err)
-					Uploadfailed++
-					Downloadfailed++
+				objectName := addr + "_" + strconv.FormatInt(r, 10)
+				p := filepath.Join(tmpDir, objectName)
+				if err := ioutil.WriteFile(p, data, 0600); err != nil {
+					log.Println(addr, "write", objectName, "failed", err)
 					continue
 				}
-
-				UploadSuccess++
-				storagekb := float64(r) / 1024.0
-				endTime := time.Now().Unix()
-				speed := storagekb / float64(endTime-beginTime)
-				fmt.Println("  Upload", objectName, "Size is", toStorageSize(r), "speed is", speed, "KB/s", "addr", addr)
-				fmt.Println(ob.String() + "address: " + addr)
-
-				//等待一会，等上传完成
-				time.Sleep(sleepInterval)
-				//下面开始下载
-				fmt.Println("  Begin to download", objectName, "Size is", toStorageSize(r), "addr", addr)
-
-				//设定输出路径
-				var p string
-				rootExists := true
-				rootIsDir := false
-				if stat, err := os.Stat(outPath); err != nil && os.IsNotExist(err) {
-					rootExists = false
-				} else if err != nil {
-					fmt.Println("  Get object", objectName, "failed: ", "addr", addr, "err", err)
-				} else if stat.IsDir() {
-					rootIsDir = true
-				}
-				if rootIsDir == true {
-					p = path.Join(outPath, objectName)
-				} else if rootExists == false {
-					p = outPath
-				} else {
-					//如果已存在，覆盖
-					p = outPath
-					fmt.Println("The outpath already has file: " + objectName)
-				}
-
-				var file *os.File
-				//已存在文件也覆盖
-				file, err = os.Create(p)
+				id, err := mgr.Upload(addr, BucketName, objectName, p)
 				if err != nil {
-					fmt.Println("  Get object", objectName, "failed: ", "addr", addr, "err", err)
+					log.Println(addr, "queue upload", objectName, "failed", err)
 					continue
 				}
-
-				beginTime = time.Now().Unix()
-				reader, err := sh.GetObject(objectName, BucketName, shell.SetAddress(addr))
-				if err != nil {
-					Downloadfailed++
-					file.Close()
-					fmt.Println("  Get object", objectName, "failed: ", "addr", addr, "err", err)
-					continue
-				}
-				written, err := io.Copy(file, reader)
-				if err != nil {
-					Downloadfailed++
-					fmt.Println("  Get object", objectName, "failed: ", "addr", addr, "err", err)
-				} else {
-					h := md5.New()
-					newOff, err := file.Seek(0, 0)
-					if err != nil {
-						Downloadfailed++
-						fmt.Println("  Change file Seek error", objectName, "addr", addr, "err", err, newOff)
-					}
-					io.Copy(h, file)
-					md5Str := hex.EncodeToString(h.Sum(nil))
-					if strings.Compare(md5Str, ob.Objects[0].MD5) == 0 {
-						DownloadSuccess++
-						fmt.Println("  Get object", objectName, "sucsess: ", toStorageSize(r), "addr", addr)
-					} else {
-						Downloadfailed++
-						fmt.Println("  Md5 check failed, Get", md5Str, "want", ob.Objects[0].MD5)
-					}
-				}
-				file.Close()
-				endTime = time.Now().Unix()
-				storagekb = float64(written) / 1024.0
-				speed = storagekb / float64(endTime-beginTime)
-				fmt.Println("  Download", objectName, "Size is", toStorageSize(r), "written is", toStorageSize(written), "speed is", speed, "KB/s", "addr", addr)
+				job, _ := mgr.Job(id)
+				mu.Lock()
+				uploads = append(uploads, job)
+				mu.Unlock()
+				fmt.Println("  Queue upload of the ", j, "st", objectName, "Size is", toStorageSize(r), "addr", addr)
 			}
-			fmt.Println(addr, "test finished.")
-			finishChan <- struct{}{}
 		}()
 	}
-	var finishedCount int
-	for {
-		select {
-		case <-finishChan:
-			finishedCount++
-			if finishedCount >= UserCount {
-				fmt.Println("Upload size", toStorageSize(UploadSize))
-				fmt.Printf("In this test:\nUpload %d Object success.\nUpload %d Object failed.\nDownload %d object success.\nDownload %d object failed.\n", UploadSuccess, Uploadfailed, DownloadSuccess, Downloadfailed)
-				fmt.Println("all tests finished, exit...")
-				return
-			}
+	wg.Wait()
+	if err := mgr.Wait(ctx); err != nil {
+		log.Fatal(err)
+	}
+
+	//等待一会，等上传完成
+	time.Sleep(sleepInterval)
+	//下面开始下载,只下载上传成功的对象
+	var UploadSize int64
+	for _, up := range uploads {
+		job, _ := mgr.Job(up.ID)
+		if job.State != shell.JobDone {
+			continue
+		}
+		UploadSize += job.Bytes
+		if _, err := mgr.Download(job.Address, job.Bucket, job.Object, downloadPath(job.Object)); err != nil {
+			log.Println(job.Address, "queue download", job.Object, "failed", err)
+		}
+	}
+	if err := mgr.Wait(ctx); err != nil {
+		log.Fatal(err)
+	}
+	if err := mgr.Err(); err != nil {
+		log.Println("transfer queue:", err)
+	}
+
+	var UploadSuccess, Uploadfailed, DownloadSuccess, Downloadfailed int
+	for _, j := range mgr.Jobs() {
+		switch {
+		case j.Kind == shell.TransferUpload && j.State == shell.JobDone:
+			UploadSuccess++
+		case j.Kind == shell.TransferUpload:
+			Uploadfailed++
+			//上传失败的对象也算下载失败
+			Downloadfailed++
+		case j.State == shell.JobDone:
+			DownloadSuccess++
+		default:
+			Downloadfailed++
 		}
 	}
+	st := mgr.Stats()
+	fmt.Println("Upload size", toStorageSize(UploadSize))
+	fmt.Println("Transferred", toStorageSize(st.Bytes), "in", st.Busy, "throughput is", st.Throughput()/1024.0, "KB/s")
+	fmt.Printf("In this test:\nUpload %d Object success.\nUpload %d Object failed.\nDownload %d object success.\nDownload %d object failed.\n", UploadSuccess, Uploadfailed, DownloadSuccess, Downloadfailed)
+	fmt.Println("all tests finished, exit...")
+}
+
+//downloadPath 返回对象的下载路径,outPath为目录时下载到其中,否则在outPath后加上对象名,每个对象各用一个路径
+func downloadPath(objectName string) string {
+	if stat, err := os.Stat(outPath); err == nil && stat.IsDir() {
+		return filepath.Join(outPath, objectName)
+	}
+	return outPath + "_" + objectName
 }
 
 func toStorageSize(r int64) string {
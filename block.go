@@ -0,0 +1,154 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	cid "github.com/ipfs/go-ipfs/source/go-cid"
+	files "github.com/ipfs/go-ipfs/source/go-ipfs-files"
+)
+
+// ErrBlockMismatch is returned when a block does not hash to its key.
+var ErrBlockMismatch = errors.New("block does not match its key")
+
+// verifyBlock checks that data hashes to the multihash of the CID key.
+func verifyBlock(key string, data []byte) error {
+	c, err := cid.Decode(key)
+	if err != nil {
+		return fmt.Errorf("invalid block key %q: %s", key, err)
+	}
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		return err
+	}
+	if !sum.Equals(c) {
+		return ErrBlockMismatch
+	}
+	return nil
+}
+
+func (s *Shell) BlockStat(path string) (string, int, error) {
+	var inf struct {
+		Key  string
+		Size int
+	}
+
+	if err := s.Request("block/stat", path).Exec(context.Background(), &inf); err != nil {
+		return "", 0, err
+	}
+	return inf.Key, inf.Size, nil
+}
+
+// BlockGet returns the data of a block. If path is a CID, the data is
+// checked against it.
+func (s *Shell) BlockGet(path string) ([]byte, error) {
+	r, err := s.BlockGetReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.TrimPrefix(path, "/ipfs/")
+	if _, err := cid.Decode(key); err == nil {
+		if err := verifyBlock(key, data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// BlockGetReader streams the data of a block. Unlike BlockGet it does not
+// check the data; the caller must close the reader.
+func (s *Shell) BlockGetReader(path string) (io.ReadCloser, error) {
+	resp, err := s.Request("block/get", path).Send(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		resp.Close()
+		return nil, resp.Error
+	}
+	return resp.Output, nil
+}
+
+// BlockPut stores a block and returns its key, after checking the key the
+// daemon computed against the data.
+func (s *Shell) BlockPut(block []byte, format, mhtype string, mhlen int) (string, error) {
+	keys, err := s.BlockPutMany([][]byte{block}, format, mhtype, mhlen)
+	if err != nil {
+		return "", err
+	}
+	return keys[0], nil
+}
+
+// BlockPutMany stores blocks in a single request and returns their keys in
+// the same order, each checked against its block.
+func (s *Shell) BlockPutMany(blocks [][]byte, format, mhtype string, mhlen int) ([]string, error) {
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+	entries := make([]files.DirEntry, 0, len(blocks))
+	for i, block := range blocks {
+		entries = append(entries, files.FileEntry(strconv.Itoa(i), files.NewBytesFile(block)))
+	}
+	fileReader := files.NewMultiFileReader(files.NewSliceDirectory(entries), true)
+
+	keys := make([]string, 0, len(blocks))
+	var out struct {
+		Key string
+	}
+	err := s.Request("block/put").
+		Option("mhtype", mhtype).
+		Option("format", format).
+		Option("mhlen", mhlen).
+		Body(fileReader).
+		DecodeStream(context.Background(), &out, func() error {
+			if len(keys) == len(blocks) {
+				return fmt.Errorf("daemon returned more than %d keys", len(blocks))
+			}
+			if err := verifyBlock(out.Key, blocks[len(keys)]); err != nil {
+				return err
+			}
+			keys = append(keys, out.Key)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) != len(blocks) {
+		return nil, fmt.Errorf("daemon returned %d keys for %d blocks", len(keys), len(blocks))
+	}
+	return keys, nil
+}
+
+// BlockRm removes blocks from the local repo. Blocks that could not be
+// removed are reported together in the returned error.
+func (s *Shell) BlockRm(hashes ...string) error {
+	var failed []string
+	var out struct {
+		Hash  string
+		Error string
+	}
+	err := s.Request("block/rm", hashes...).DecodeStream(context.Background(), &out, func() error {
+		if out.Error != "" {
+			failed = append(failed, out.Hash+": "+out.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to remove blocks: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package shell
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/cheekybits/is"
+	cid "github.com/ipfs/go-ipfs/source/go-cid"
+	mh "github.com/ipfs/go-ipfs/source/go-multihash"
+	"github.com/xcshuan/go-mefs-api/internal/fakedaemon"
+)
+
+func TestBlockPutMany(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	tamper := false
+	requests := 0
+	d.Handle("block/put", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		mr, err := r.MultipartReader()
+		if err != nil {
+			fakedaemon.Error(w, err.Error())
+			return
+		}
+		enc := json.NewEncoder(w)
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return
+			}
+			data, _ := ioutil.ReadAll(part)
+			if tamper {
+				data = append(data, '!')
+			}
+			c, _ := cid.NewPrefixV0(mh.SHA2_256).Sum(data)
+			enc.Encode(struct{ Key string }{c.String()})
+		}
+	})
+
+	blocks := [][]byte{[]byte("one"), []byte("two"), []byte("three")}
+	keys, err := s.BlockPutMany(blocks, "v0", "sha2-256", -1)
+	is.NoErr(err)
+	is.Equal(len(keys), 3)
+	is.Equal(requests, 1)
+	for i, key := range keys {
+		is.NoErr(verifyBlock(key, blocks[i]))
+	}
+
+	tamper = true
+	_, err = s.BlockPut([]byte("one"), "v0", "sha2-256", -1)
+	is.Equal(err, ErrBlockMismatch)
+}
+
+func TestBlockGet(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	c, err := cid.NewPrefixV0(mh.SHA2_256).Sum([]byte("data"))
+	is.NoErr(err)
+	served := "data"
+	d.Handle("block/get", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(served))
+	})
+
+	data, err := s.BlockGet(c.String())
+	is.NoErr(err)
+	is.Equal(string(data), "data")
+
+	served = "tampered"
+	_, err = s.BlockGet("/ipfs/" + c.String())
+	is.Equal(err, ErrBlockMismatch)
+
+	r, err := s.BlockGetReader(c.String())
+	is.NoErr(err)
+	data, err = ioutil.ReadAll(r)
+	is.NoErr(err)
+	is.NoErr(r.Close())
+	is.Equal(string(data), "tampered")
+}
+
+func TestBlockRm(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	d.Handle("block/rm", func(w http.ResponseWriter, r *http.Request) {
+		enc := json.NewEncoder(w)
+		for _, h := range r.URL.Query()["arg"] {
+			out := map[string]string{"Hash": h}
+			if h == "QmMissing" {
+				out["Error"] = "blockstore: block not found"
+			}
+			enc.Encode(out)
+		}
+	})
+
+	is.NoErr(s.BlockRm("QmA", "QmB"))
+	err := s.BlockRm("QmA", "QmMissing")
+	is.Err(err)
+	is.Equal(err.Error(), "failed to remove blocks: QmMissing: blockstore: block not found")
+}
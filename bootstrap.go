@@ -2,15 +2,40 @@ package shell
 
 import (
 	"context"
+	"fmt"
+
+	ma "github.com/ipfs/go-ipfs/source/go-multiaddr"
 )
 
 type PeersList struct {
 	Peers []string
 }
 
+// checkBootstrapPeers makes sure every peer is a multiaddr ending in
+// /ipfs/<peerID> and returns them in canonical form.
+func checkBootstrapPeers(peers []string) ([]string, error) {
+	out := make([]string, 0, len(peers))
+	for _, p := range peers {
+		a, err := ma.NewMultiaddr(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bootstrap peer %q: %s", p, err)
+		}
+		parts := ma.Split(a)
+		if len(parts) < 2 || parts[len(parts)-1].Protocols()[0].Code != ma.P_IPFS {
+			return nil, fmt.Errorf("invalid bootstrap peer %q: must be an address ending in /ipfs/<peerID>", p)
+		}
+		out = append(out, a.String())
+	}
+	return out, nil
+}
+
 func (s *Shell) BootstrapAdd(peers []string) ([]string, error) {
+	peers, err := checkBootstrapPeers(peers)
+	if err != nil {
+		return nil, err
+	}
 	var addOutput PeersList
-	err := s.Request("bootstrap/add", peers...).Exec(context.Background(), &addOutput)
+	err = s.Request("bootstrap/add", peers...).Exec(context.Background(), &addOutput)
 	return addOutput.Peers, err
 }
 
@@ -20,8 +45,78 @@ func (s *Shell) BootstrapAddDefault() ([]string, error) {
 	return addOutput.Peers, err
 }
 
+// BootstrapList returns the peers the node bootstraps from.
+func (s *Shell) BootstrapList() ([]string, error) {
+	var listOutput PeersList
+	err := s.Request("bootstrap/list").Exec(context.Background(), &listOutput)
+	return listOutput.Peers, err
+}
+
+// BootstrapRm removes the given peers from the bootstrap list.
+func (s *Shell) BootstrapRm(peers []string) ([]string, error) {
+	peers, err := checkBootstrapPeers(peers)
+	if err != nil {
+		return nil, err
+	}
+	var rmOutput PeersList
+	err = s.Request("bootstrap/rm", peers...).Exec(context.Background(), &rmOutput)
+	return rmOutput.Peers, err
+}
+
 func (s *Shell) BootstrapRmAll() ([]string, error) {
 	var rmAllOutput PeersList
 	err := s.Request("bootstrap/rm/all").Exec(context.Background(), &rmAllOutput)
 	return rmAllOutput.Peers, err
 }
+
+// BootstrapSet makes the bootstrap list exactly peers, removing and adding
+// only what differs. It returns the peers it added and removed.
+func (s *Shell) BootstrapSet(peers []string) (added, removed []string, err error) {
+	want, err := checkBootstrapPeers(peers)
+	if err != nil {
+		return nil, nil, err
+	}
+	current, err := s.BootstrapList()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wantSet := make(map[string]bool, len(want))
+	for _, p := range want {
+		wantSet[p] = true
+	}
+	haveSet := make(map[string]bool, len(current))
+	var toRm, toAdd []string
+	for _, p := range current {
+		// compare the daemon's entries in canonical form too, but remove
+		// them as the daemon spelled them
+		key := p
+		if a, err := ma.NewMultiaddr(p); err == nil {
+			key = a.String()
+		}
+		haveSet[key] = true
+		if !wantSet[key] {
+			toRm = append(toRm, p)
+		}
+	}
+	for _, p := range want {
+		if !haveSet[p] {
+			toAdd = append(toAdd, p)
+			haveSet[p] = true
+		}
+	}
+
+	if len(toRm) > 0 {
+		var rmOutput PeersList
+		if err := s.Request("bootstrap/rm", toRm...).Exec(context.Background(), &rmOutput); err != nil {
+			return nil, nil, err
+		}
+		removed = rmOutput.Peers
+	}
+	if len(toAdd) > 0 {
+		if added, err = s.BootstrapAdd(toAdd); err != nil {
+			return nil, removed, err
+		}
+	}
+	return added, removed, nil
+}
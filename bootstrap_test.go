@@ -0,0 +1,65 @@
+package shell
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/cheekybits/is"
+	"github.com/xcshuan/go-mefs-api/internal/fakedaemon"
+)
+
+const (
+	bootA = "/ip4/10.0.0.1/tcp/4001/ipfs/QmSoLPppuBtQSGwKDZT2M73ULpjvfd3aZ6ha4oFGL1KrGM"
+	bootB = "/ip4/10.0.0.2/tcp/4001/ipfs/QmSoLSafTMBsPKadTEgaXctDQVcqN88CNLHXMkTNwMKPnu"
+	bootC = "/ip4/10.0.0.3/tcp/4001/ipfs/QmSoLueR4xBeUbY9WZ9xGUUxunbKWcrNFTDAadQJmocnWm"
+)
+
+func TestCheckBootstrapPeers(t *testing.T) {
+	is := is.New(t)
+
+	_, err := checkBootstrapPeers([]string{bootA, bootB})
+	is.NoErr(err)
+
+	for _, bad := range []string{
+		"10.0.0.1:4001",
+		"/ip4/10.0.0.1/tcp/4001",
+		"/ipfs/QmSoLPppuBtQSGwKDZT2M73ULpjvfd3aZ6ha4oFGL1KrGM",
+		"/ip4/10.0.0.1/tcp/4001/ipfs/notapeer",
+	} {
+		_, err := checkBootstrapPeers([]string{bad})
+		is.Err(err)
+	}
+}
+
+func TestBootstrapSet(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	list := []string{bootA, bootB}
+	d.Handle("bootstrap/list", func(w http.ResponseWriter, r *http.Request) {
+		fakedaemon.JSON(w, PeersList{Peers: list})
+	})
+	var rmArgs, addArgs []string
+	d.Handle("bootstrap/rm", func(w http.ResponseWriter, r *http.Request) {
+		rmArgs = r.URL.Query()["arg"]
+		fakedaemon.JSON(w, PeersList{Peers: rmArgs})
+	})
+	d.Handle("bootstrap/add", func(w http.ResponseWriter, r *http.Request) {
+		addArgs = r.URL.Query()["arg"]
+		fakedaemon.JSON(w, PeersList{Peers: addArgs})
+	})
+
+	added, removed, err := s.BootstrapSet([]string{bootB, bootC})
+	is.NoErr(err)
+	is.Equal(rmArgs, []string{bootA})
+	is.Equal(removed, []string{bootA})
+	want, err := checkBootstrapPeers([]string{bootC})
+	is.NoErr(err)
+	is.Equal(addArgs, want)
+	is.Equal(added, want)
+
+	_, _, err = s.BootstrapSet([]string{"/ip4/10.0.0.1/tcp/4001"})
+	is.Err(err)
+}
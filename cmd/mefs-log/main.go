@@ -0,0 +1,111 @@
+// mefs-log inspects and controls the log of a running mefs daemon.
+//
+//	mefs-log [-api addr] ls
+//	mefs-log [-api addr] level <subsystem|all> <level>
+//	mefs-log [-api addr] tail [-system lfs,...] [-level info]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/xcshuan/go-mefs-api"
+)
+
+const usage = `usage: mefs-log [-api addr] <command>
+
+commands:
+  ls                           list the log subsystems
+  level <subsystem|all> <lvl>  set the level of a subsystem to debug, info,
+                               warning, error or critical
+  tail [-system s,...] [-level lvl]
+                               follow the log
+`
+
+func main() {
+	api := flag.String("api", "", "address of the daemon API, defaults to the local node")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	var sh *shell.Shell
+	if *api != "" {
+		sh = shell.NewShell(*api)
+	} else {
+		sh = shell.NewLocalShell()
+	}
+	if sh == nil {
+		fatal("cannot find a local daemon, use -api")
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "ls":
+		subs, err := sh.LogList()
+		if err != nil {
+			fatal(err)
+		}
+		for _, sub := range subs {
+			fmt.Println(sub)
+		}
+	case "level":
+		if len(args) != 3 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		if err := sh.LogLevel(args[1], args[2]); err != nil {
+			fatal(err)
+		}
+		fmt.Printf("set %s to %s\n", args[1], args[2])
+	case "tail":
+		tail(sh, args[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func tail(sh *shell.Shell, args []string) {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	systems := fs.String("system", "", "comma separated subsystems to show")
+	level := fs.String("level", "", "least severe level to show")
+	fs.Parse(args)
+
+	var filter shell.LogFilter
+	if *systems != "" {
+		filter.Systems = strings.Split(*systems, ",")
+	}
+	filter.Level = *level
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	logger, err := sh.GetFilteredLogs(ctx, filter)
+	if err != nil {
+		fatal(err)
+	}
+	for ev := range logger.Subscribe(ctx) {
+		fmt.Println(ev)
+	}
+	if err := logger.Err(); err != nil && err != context.Canceled {
+		fatal(err)
+	}
+}
+
+func fatal(v interface{}) {
+	fmt.Fprintln(os.Stderr, "mefs-log:", v)
+	os.Exit(1)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// fileSystem serves a mount through FUSE. Nodes only hold their path;
+// everything else is asked of the mount.
+type fileSystem struct {
+	m *mount
+}
+
+func (fsys fileSystem) Root() (fs.Node, error) {
+	return node{fsys.m, "/"}, nil
+}
+
+// fuseErr maps the errors of the mount to errnos.
+func fuseErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case os.IsNotExist(err):
+		return fuse.ENOENT
+	case os.IsExist(err):
+		return fuse.EEXIST
+	case os.IsPermission(err):
+		return fuse.EPERM
+	case err == errNotEmpty:
+		return fuse.Errno(syscall.ENOTEMPTY)
+	case err == errNotSupported:
+		return fuse.ENOTSUP
+	default:
+		// the default, EIO, loses the message
+		logf("%s", err)
+		return fuse.EIO
+	}
+}
+
+type node struct {
+	m    *mount
+	path string
+}
+
+var (
+	_ fs.NodeStringLookuper = node{}
+	_ fs.HandleReadDirAller = node{}
+	_ fs.NodeMkdirer        = node{}
+	_ fs.NodeCreater        = node{}
+	_ fs.NodeOpener         = node{}
+	_ fs.NodeRemover        = node{}
+	_ fs.NodeRenamer        = node{}
+	_ fs.NodeSetattrer      = node{}
+
+	_ fs.HandleReader   = fileHandle{}
+	_ fs.HandleWriter   = fileHandle{}
+	_ fs.HandleFlusher  = fileHandle{}
+	_ fs.HandleReleaser = fileHandle{}
+)
+
+func (n node) Attr(ctx context.Context, a *fuse.Attr) error {
+	e, err := n.m.stat(n.path)
+	if err != nil {
+		return fuseErr(err)
+	}
+	setAttr(a, e)
+	return nil
+}
+
+func setAttr(a *fuse.Attr, e entry) {
+	a.Mtime = e.mtime
+	a.Ctime = e.mtime
+	if e.dir {
+		a.Mode = os.ModeDir | 0755
+		return
+	}
+	a.Mode = 0644
+	a.Size = uint64(e.size)
+}
+
+func (n node) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	p := path.Join(n.path, name)
+	if _, err := n.m.stat(p); err != nil {
+		return nil, fuseErr(err)
+	}
+	return node{n.m, p}, nil
+}
+
+func (n node) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	ents, err := n.m.readDir(n.path)
+	if err != nil {
+		return nil, fuseErr(err)
+	}
+	dirents := make([]fuse.Dirent, 0, len(ents))
+	for _, e := range ents {
+		typ := fuse.DT_File
+		if e.dir {
+			typ = fuse.DT_Dir
+		}
+		dirents = append(dirents, fuse.Dirent{Name: e.name, Type: typ})
+	}
+	return dirents, nil
+}
+
+func (n node) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
+	p := path.Join(n.path, req.Name)
+	if err := n.m.mkdir(p); err != nil {
+		return nil, fuseErr(err)
+	}
+	return node{n.m, p}, nil
+}
+
+func (n node) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	p := path.Join(n.path, req.Name)
+	h, err := n.m.open(p, true, true, true)
+	if err != nil {
+		return nil, nil, fuseErr(err)
+	}
+	return node{n.m, p}, fileHandle{h}, nil
+}
+
+func (n node) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if req.Dir {
+		return n, nil
+	}
+	h, err := n.m.open(n.path, !req.Flags.IsReadOnly(), req.Flags&fuse.OpenTruncate != 0, false)
+	if err != nil {
+		return nil, fuseErr(err)
+	}
+	return fileHandle{h}, nil
+}
+
+func (n node) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	return fuseErr(n.m.remove(path.Join(n.path, req.Name), req.Dir))
+}
+
+func (n node) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Node) error {
+	dir, ok := newDir.(node)
+	if !ok {
+		return fuse.EIO
+	}
+	return fuseErr(n.m.rename(path.Join(n.path, req.OldName), path.Join(dir.path, req.NewName)))
+}
+
+func (n node) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	if req.Valid.Size() {
+		var err error
+		// an open file is truncated in its buffer and uploaded on close
+		if buf := n.m.buffer(n.path); buf != nil {
+			err = buf.truncate(int64(req.Size))
+		} else {
+			err = n.m.truncate(n.path, int64(req.Size))
+		}
+		if err != nil {
+			return fuseErr(err)
+		}
+	}
+	e, err := n.m.stat(n.path)
+	if err != nil {
+		return fuseErr(err)
+	}
+	setAttr(&resp.Attr, e)
+	return nil
+}
+
+type fileHandle struct {
+	h *handle
+}
+
+func (fh fileHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	data, err := fh.h.readAt(req.Offset, req.Size)
+	if err != nil {
+		return fuseErr(err)
+	}
+	resp.Data = data
+	return nil
+}
+
+func (fh fileHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	n, err := fh.h.writeAt(req.Data, req.Offset)
+	resp.Size = n
+	return fuseErr(err)
+}
+
+// Flush is called on every close(2) of the file, so that is when what was
+// written is uploaded.
+func (fh fileHandle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	return fuseErr(fh.h.flush())
+}
+
+func (fh fileHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	return fuseErr(fh.h.release())
+}
@@ -0,0 +1,113 @@
+// mefs-mount mounts the buckets of a mefs user as a file system.
+//
+//	mefs-mount [-api addr] [-address user] [-tmp dir] <mountpoint>
+//
+// The directories of the mount point are the buckets of the user, and the
+// files below them their objects; slashes in object names show up as
+// directories. Files written are kept in the temporary directory and
+// uploaded when they are closed. Unmount with fusermount -u, or stop
+// mefs-mount with an interrupt.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/xcshuan/go-mefs-api"
+)
+
+const usage = `usage: mefs-mount [flags] <mountpoint>
+
+flags:
+`
+
+var verbose bool
+
+func main() {
+	api := flag.String("api", "", "address of the daemon API, defaults to the local node")
+	address := flag.String("address", "", "user whose buckets to mount, defaults to the daemon's")
+	tmp := flag.String("tmp", "", "directory for the files being written, defaults to a new temporary one")
+	metaTTL := flag.Duration("meta-ttl", 5*time.Second, "how long to cache object metadata, 0 to disable")
+	cacheDir := flag.String("cache", "", "directory to cache downloaded objects in")
+	cacheSize := flag.Int64("cache-size", 1<<30, "most bytes kept in the cache directory")
+	flag.BoolVar(&verbose, "v", false, "log the errors returned to the kernel")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	mountpoint := flag.Arg(0)
+
+	var sh *shell.Shell
+	if *api != "" {
+		sh = shell.NewShell(*api)
+	} else {
+		sh = shell.NewLocalShell()
+	}
+	if sh == nil {
+		fatal("cannot find a local daemon, use -api")
+	}
+	if *metaTTL > 0 {
+		sh.EnableMetaCache(4096, *metaTTL)
+	}
+	if *cacheDir != "" {
+		if err := sh.EnableContentCache(*cacheDir, *cacheSize); err != nil {
+			fatal(err)
+		}
+	}
+
+	var opts []shell.LfsOpts
+	if *address != "" {
+		opts = append(opts, shell.SetAddress(*address))
+	}
+	if *tmp == "" {
+		dir, err := ioutil.TempDir("", "mefs-mount")
+		if err != nil {
+			fatal(err)
+		}
+		// buffers whose upload failed are left for the user to recover
+		defer os.Remove(dir)
+		*tmp = dir
+	}
+
+	c, err := fuse.Mount(mountpoint, fuse.FSName("mefs"), fuse.Subtype("mefs"))
+	if err != nil {
+		fatal(err)
+	}
+	defer c.Close()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		if err := fuse.Unmount(mountpoint); err != nil {
+			log.Println("unmount:", err)
+		}
+	}()
+
+	if err := fs.Serve(c, fileSystem{newMount(sh, *tmp, opts...)}); err != nil {
+		fatal(err)
+	}
+}
+
+func logf(format string, args ...interface{}) {
+	if verbose {
+		log.Printf(format, args...)
+	}
+}
+
+func fatal(v interface{}) {
+	fmt.Fprintln(os.Stderr, "mefs-mount:", v)
+	os.Exit(1)
+}
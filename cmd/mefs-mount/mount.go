@@ -0,0 +1,627 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xcshuan/go-mefs-api"
+)
+
+var (
+	errNotEmpty     = errors.New("directory not empty")
+	errNotSupported = errors.New("operation not supported")
+)
+
+// uploadSuffix names the object a changed file is uploaded to before it
+// replaces the old one. It is hidden while the old one exists; once that is
+// gone it may hold the only copy of the data, and shows.
+const uploadSuffix = ".mefs-mount-upload"
+
+// entry is a file or a directory of the mount.
+type entry struct {
+	name  string
+	dir   bool
+	size  int64
+	mtime time.Time
+}
+
+// mount maps file system operations on slash separated paths to the
+// buckets and objects of a user. The directories of the root are buckets;
+// below them the slashes in object names make up directories, and empty
+// directories only live in memory until a file is written into them.
+//
+// Files opened for writing are buffered in tmpDir and uploaded when they
+// are closed. The daemon does not overwrite objects, so an object written
+// to is uploaded next to the old one, which it then replaces.
+type mount struct {
+	sh     *shell.Shell
+	opts   []shell.LfsOpts
+	tmpDir string
+
+	mu   sync.Mutex
+	dirs map[string]bool
+	bufs map[string]*buffer
+}
+
+func newMount(sh *shell.Shell, tmpDir string, opts ...shell.LfsOpts) *mount {
+	return &mount{
+		sh:     sh,
+		opts:   opts,
+		tmpDir: tmpDir,
+		dirs:   make(map[string]bool),
+		bufs:   make(map[string]*buffer),
+	}
+}
+
+// splitPath returns the bucket and the object name of p, either of which
+// is empty for the root and for buckets.
+func splitPath(p string) (bucket, object string) {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if i := strings.IndexByte(p, '/'); i >= 0 {
+		return p[:i], p[i+1:]
+	}
+	return p, ""
+}
+
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// isNotExist tells whether err is the daemon saying there is no such
+// bucket or object.
+func isNotExist(err error) bool {
+	e, ok := err.(*shell.Error)
+	return ok && strings.Contains(e.Message, "not exist")
+}
+
+func notExist(err error) error {
+	if isNotExist(err) {
+		return os.ErrNotExist
+	}
+	return err
+}
+
+func (m *mount) stat(p string) (entry, error) {
+	p = cleanPath(p)
+	bucket, object := splitPath(p)
+	if bucket == "" {
+		return entry{name: "/", dir: true}, nil
+	}
+	if object == "" {
+		bks, err := m.sh.HeadBucket(bucket, m.opts...)
+		if err != nil {
+			return entry{}, notExist(err)
+		}
+		e := entry{name: bucket, dir: true}
+		if len(bks.Buckets) > 0 {
+			e.mtime = bks.Buckets[0].Ctime.Time
+		}
+		return e, nil
+	}
+
+	if buf := m.buffer(p); buf != nil {
+		return buf.entry(), nil
+	}
+	objs, err := m.sh.HeadObject(object, bucket, m.opts...)
+	if err != nil && !isNotExist(err) {
+		return entry{}, err
+	}
+	if err == nil && len(objs.Objects) > 0 {
+		ob := objs.Objects[0]
+		return entry{name: path.Base(p), dir: ob.Dir, size: ob.ObjectSize, mtime: ob.Ctime.Time}, nil
+	}
+	dir, err := m.isDir(p)
+	if err != nil {
+		return entry{}, err
+	}
+	if !dir {
+		return entry{}, os.ErrNotExist
+	}
+	return entry{name: path.Base(p), dir: true}, nil
+}
+
+// isDir tells whether p, below a bucket, is a directory that holds
+// objects or was made with mkdir.
+func (m *mount) isDir(p string) (bool, error) {
+	m.mu.Lock()
+	made := m.dirs[p]
+	m.mu.Unlock()
+	if made {
+		return true, nil
+	}
+	bucket, object := splitPath(p)
+	objs, err := m.sh.ListObjects(bucket, append(m.opts[:len(m.opts):len(m.opts)], shell.SetPrefixFilter(object+"/"))...)
+	if err != nil {
+		return false, notExist(err)
+	}
+	for _, ob := range objs.Objects {
+		if strings.HasPrefix(ob.ObjectName, object+"/") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mount) readDir(p string) ([]entry, error) {
+	p = cleanPath(p)
+	bucket, object := splitPath(p)
+	if bucket == "" {
+		bks, err := m.sh.ListBuckets(m.opts...)
+		if err != nil {
+			return nil, err
+		}
+		ents := make([]entry, 0, len(bks.Buckets))
+		for _, bk := range bks.Buckets {
+			ents = append(ents, entry{name: bk.BucketName, dir: true, mtime: bk.Ctime.Time})
+		}
+		return ents, nil
+	}
+
+	prefix := ""
+	if object != "" {
+		prefix = object + "/"
+	}
+	objs, err := m.sh.ListObjects(bucket, append(m.opts[:len(m.opts):len(m.opts)], shell.SetPrefixFilter(prefix))...)
+	if err != nil {
+		return nil, notExist(err)
+	}
+	stored := make(map[string]bool, len(objs.Objects))
+	for _, ob := range objs.Objects {
+		stored[ob.ObjectName] = true
+	}
+	byName := make(map[string]entry)
+	for _, ob := range objs.Objects {
+		if !strings.HasPrefix(ob.ObjectName, prefix) || ob.ObjectName == prefix {
+			continue
+		}
+		if strings.HasSuffix(ob.ObjectName, uploadSuffix) && stored[strings.TrimSuffix(ob.ObjectName, uploadSuffix)] {
+			continue
+		}
+		rest := ob.ObjectName[len(prefix):]
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			byName[rest[:i]] = entry{name: rest[:i], dir: true}
+			continue
+		}
+		byName[rest] = entry{name: rest, dir: ob.Dir, size: ob.ObjectSize, mtime: ob.Ctime.Time}
+	}
+
+	// directories and files not uploaded yet
+	m.mu.Lock()
+	for d := range m.dirs {
+		if path.Dir(d) == p {
+			byName[path.Base(d)] = entry{name: path.Base(d), dir: true}
+		}
+	}
+	var bufs []*buffer
+	for bp, buf := range m.bufs {
+		if path.Dir(bp) == p {
+			bufs = append(bufs, buf)
+		}
+	}
+	m.mu.Unlock()
+	for _, buf := range bufs {
+		e := buf.entry()
+		byName[e.name] = e
+	}
+
+	ents := make([]entry, 0, len(byName))
+	for _, e := range byName {
+		ents = append(ents, e)
+	}
+	sort.Slice(ents, func(i, j int) bool { return ents[i].name < ents[j].name })
+	return ents, nil
+}
+
+// readAt reads the file at p from off on, from its write buffer if it has
+// one and else with a ranged download.
+func (m *mount) readAt(p string, off int64, size int) ([]byte, error) {
+	p = cleanPath(p)
+	if buf := m.buffer(p); buf != nil {
+		return buf.readAt(off, size)
+	}
+	bucket, object := splitPath(p)
+	r, err := m.sh.GetObject(object, bucket, append(m.opts[:len(m.opts):len(m.opts)], shell.SetRange(off, int64(size)))...)
+	if err != nil {
+		return nil, notExist(err)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(r, int64(size)))
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (m *mount) mkdir(p string) error {
+	p = cleanPath(p)
+	bucket, object := splitPath(p)
+	if bucket == "" {
+		return os.ErrExist
+	}
+	if object == "" {
+		_, err := m.sh.CreateBucket(bucket, m.opts...)
+		return err
+	}
+	if _, err := m.stat(p); err == nil {
+		return os.ErrExist
+	}
+	m.mu.Lock()
+	m.dirs[p] = true
+	m.mu.Unlock()
+	return nil
+}
+
+// remove removes the file or, if dir is set, the empty directory at p.
+func (m *mount) remove(p string, dir bool) error {
+	p = cleanPath(p)
+	bucket, object := splitPath(p)
+	if bucket == "" {
+		return errNotSupported
+	}
+	if object == "" {
+		_, err := m.sh.DeleteBucket(bucket, m.opts...)
+		if err != nil && strings.Contains(err.Error(), "not empty") {
+			return errNotEmpty
+		}
+		return notExist(err)
+	}
+
+	if dir {
+		ents, err := m.readDir(p)
+		if err != nil {
+			return err
+		}
+		if len(ents) > 0 {
+			return errNotEmpty
+		}
+		m.mu.Lock()
+		delete(m.dirs, p)
+		m.mu.Unlock()
+		return nil
+	}
+
+	if buf := m.buffer(p); buf != nil {
+		// an open file is gone once closed
+		buf.mu.Lock()
+		buf.removed = true
+		uploaded := buf.uploaded
+		buf.mu.Unlock()
+		m.mu.Lock()
+		if m.bufs[p] == buf {
+			delete(m.bufs, p)
+		}
+		m.mu.Unlock()
+		if !uploaded {
+			return nil
+		}
+	}
+	_, err := m.sh.DeleteObject(object, bucket, m.opts...)
+	return notExist(err)
+}
+
+// rename moves the file or directory at from to to, replacing the file
+// at to if there is one. Buckets can not be renamed.
+func (m *mount) rename(from, to string) error {
+	from, to = cleanPath(from), cleanPath(to)
+	fromBucket, fromObject := splitPath(from)
+	toBucket, toObject := splitPath(to)
+	if fromObject == "" || toObject == "" {
+		return errNotSupported
+	}
+
+	e, err := m.stat(from)
+	if err != nil {
+		return err
+	}
+	if !e.dir {
+		if buf := m.buffer(from); buf != nil {
+			if err := buf.flush(m); err != nil {
+				return err
+			}
+			// path is guarded by both locks, taken in the order flush does
+			buf.mu.Lock()
+			m.mu.Lock()
+			delete(m.bufs, from)
+			m.bufs[to] = buf
+			buf.path = to
+			m.mu.Unlock()
+			buf.mu.Unlock()
+		}
+		return m.move(fromBucket, fromObject, toBucket, toObject)
+	}
+
+	objs, err := m.sh.ListObjects(fromBucket, append(m.opts[:len(m.opts):len(m.opts)], shell.SetPrefixFilter(fromObject+"/"))...)
+	if err != nil {
+		return err
+	}
+	for _, ob := range objs.Objects {
+		if !strings.HasPrefix(ob.ObjectName, fromObject+"/") {
+			continue
+		}
+		dst := toObject + strings.TrimPrefix(ob.ObjectName, fromObject)
+		if err := m.move(fromBucket, ob.ObjectName, toBucket, dst); err != nil {
+			return err
+		}
+	}
+	m.mu.Lock()
+	if m.dirs[from] {
+		delete(m.dirs, from)
+		m.dirs[to] = true
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *mount) move(fromBucket, fromObject, toBucket, toObject string) error {
+	if _, err := m.sh.DeleteObject(toObject, toBucket, m.opts...); err != nil && !isNotExist(err) {
+		return err
+	}
+	_, err := m.sh.MoveObject(fromBucket, fromObject, toBucket, toObject, m.opts...)
+	return notExist(err)
+}
+
+// open returns a handle on the file at p. Handles that write share the
+// write buffer of the file, which is filled with the object unless trunc
+// is set or the file is new. Unless create is set the file must exist.
+func (m *mount) open(p string, write, trunc, create bool) (*handle, error) {
+	p = cleanPath(p)
+	bucket, object := splitPath(p)
+	if object == "" {
+		return nil, errNotSupported
+	}
+	if !write {
+		if _, err := m.stat(p); err != nil {
+			return nil, err
+		}
+		return &handle{m: m, path: p}, nil
+	}
+
+	m.mu.Lock()
+	buf, ok := m.bufs[p]
+	if ok {
+		buf.refs++
+	}
+	m.mu.Unlock()
+	if !ok {
+		var err error
+		if buf, err = m.newBuffer(p, bucket, object, trunc, create); err != nil {
+			return nil, err
+		}
+		m.mu.Lock()
+		if other, ok := m.bufs[p]; ok {
+			// lost a race with another open
+			buf.discard()
+			buf = other
+		} else {
+			m.bufs[p] = buf
+		}
+		buf.refs++
+		m.mu.Unlock()
+	}
+	if trunc && ok {
+		if err := buf.truncate(0); err != nil {
+			m.release(buf)
+			return nil, err
+		}
+	}
+	return &handle{m: m, path: p, buf: buf}, nil
+}
+
+func (m *mount) newBuffer(p, bucket, object string, trunc, create bool) (*buffer, error) {
+	f, err := ioutil.TempFile(m.tmpDir, "write-*")
+	if err != nil {
+		return nil, err
+	}
+	buf := &buffer{path: p, f: f, dirty: trunc || create}
+
+	if !buf.dirty {
+		r, err := m.sh.GetObject(object, bucket, m.opts...)
+		if err == nil {
+			buf.size, err = io.Copy(f, r)
+			r.Close()
+			buf.uploaded = true
+		}
+		if err != nil {
+			buf.discard()
+			return nil, notExist(err)
+		}
+	} else if !create {
+		// truncating an object replaces it, but does not make one
+		if _, err := m.sh.HeadObject(object, bucket, m.opts...); err != nil {
+			buf.discard()
+			return nil, notExist(err)
+		}
+		buf.uploaded = true
+	}
+	return buf, nil
+}
+
+func (m *mount) buffer(p string) *buffer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.bufs[p]
+}
+
+// release drops a reference to buf, uploading it if it is the last one.
+// If the upload fails the buffer file is left in tmpDir.
+func (m *mount) release(buf *buffer) error {
+	m.mu.Lock()
+	buf.refs--
+	last := buf.refs == 0
+	if last && m.bufs[buf.path] == buf {
+		delete(m.bufs, buf.path)
+	}
+	m.mu.Unlock()
+	if !last {
+		return nil
+	}
+	if err := buf.flush(m); err != nil {
+		buf.f.Close()
+		log.Printf("upload of %s failed, its data is kept in %s: %s", buf.path, buf.f.Name(), err)
+		return err
+	}
+	buf.discard()
+	return nil
+}
+
+// truncate sets the size of the file at p, as with truncate(2).
+func (m *mount) truncate(p string, size int64) error {
+	h, err := m.open(p, true, size == 0, false)
+	if err != nil {
+		return err
+	}
+	if size != 0 {
+		if err := h.buf.truncate(size); err != nil {
+			h.release()
+			return err
+		}
+	}
+	return h.release()
+}
+
+// handle is an open file of the mount; buf is nil for files opened for
+// reading only.
+type handle struct {
+	m    *mount
+	path string
+	buf  *buffer
+}
+
+func (h *handle) readAt(off int64, size int) ([]byte, error) {
+	if h.buf != nil {
+		return h.buf.readAt(off, size)
+	}
+	return h.m.readAt(h.path, off, size)
+}
+
+func (h *handle) writeAt(data []byte, off int64) (int, error) {
+	if h.buf == nil {
+		return 0, os.ErrPermission
+	}
+	return h.buf.writeAt(data, off)
+}
+
+// flush uploads what was written so far.
+func (h *handle) flush() error {
+	if h.buf == nil {
+		return nil
+	}
+	return h.buf.flush(h.m)
+}
+
+func (h *handle) release() error {
+	if h.buf == nil {
+		return nil
+	}
+	return h.m.release(h.buf)
+}
+
+// buffer holds the data of a file opened for writing.
+type buffer struct {
+	mu sync.Mutex
+	// path is changed with both mu and the mount's lock held, refs with
+	// the mount's lock only.
+	path  string
+	f     *os.File
+	size  int64
+	mtime time.Time
+	refs  int
+	// dirty is set while the file has changes not uploaded, uploaded
+	// once the object exists, and removed once the file was unlinked.
+	dirty    bool
+	uploaded bool
+	removed  bool
+}
+
+func (b *buffer) entry() entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return entry{name: path.Base(b.path), size: b.size, mtime: b.mtime}
+}
+
+func (b *buffer) readAt(off int64, size int) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data := make([]byte, size)
+	n, err := b.f.ReadAt(data, off)
+	if err == io.EOF {
+		err = nil
+	}
+	return data[:n], err
+}
+
+func (b *buffer) writeAt(data []byte, off int64) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n, err := b.f.WriteAt(data, off)
+	if end := off + int64(n); end > b.size {
+		b.size = end
+	}
+	b.dirty = true
+	b.mtime = time.Now()
+	return n, err
+}
+
+func (b *buffer) truncate(size int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.f.Truncate(size); err != nil {
+		return err
+	}
+	b.size = size
+	b.dirty = true
+	b.mtime = time.Now()
+	return nil
+}
+
+// flush uploads the buffer if it has changed.
+func (b *buffer) flush(m *mount) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.dirty || b.removed {
+		return nil
+	}
+	bucket, object := splitPath(b.path)
+	if !b.uploaded {
+		if _, err := m.sh.PutObject(io.NewSectionReader(b.f, 0, b.size), object, bucket, m.opts...); err != nil {
+			return err
+		}
+	} else {
+		// the old object stays until the new data is safely stored
+		tmp := object + uploadSuffix
+		if _, err := m.sh.DeleteObject(tmp, bucket, m.opts...); err != nil && !isNotExist(err) {
+			return err
+		}
+		if _, err := m.sh.PutObject(io.NewSectionReader(b.f, 0, b.size), tmp, bucket, m.opts...); err != nil {
+			m.sh.DeleteObject(tmp, bucket, m.opts...)
+			return err
+		}
+		if err := m.move(bucket, tmp, bucket, object); err != nil {
+			log.Printf("replacing %s failed, its data is kept in %s/%s: %s", b.path, bucket, tmp, err)
+			return err
+		}
+	}
+	b.dirty = false
+	b.uploaded = true
+
+	// the directories above it are real now
+	m.mu.Lock()
+	for d := path.Dir(b.path); d != "/"; d = path.Dir(d) {
+		delete(m.dirs, d)
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+func (b *buffer) discard() {
+	b.f.Close()
+	os.Remove(b.f.Name())
+}
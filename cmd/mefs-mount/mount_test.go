@@ -0,0 +1,294 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cheekybits/is"
+	"github.com/xcshuan/go-mefs-api"
+	"github.com/xcshuan/go-mefs-api/internal/fakedaemon"
+)
+
+// fakeDaemon adds the helpers of these tests to the shared fake daemon.
+type fakeDaemon struct {
+	*fakedaemon.Daemon
+}
+
+func (d *fakeDaemon) Shell() *shell.Shell {
+	return shell.NewShell(strings.TrimPrefix(d.URL, "http://"))
+}
+
+func (d *fakeDaemon) object(bucket, name string) (string, bool) {
+	data, ok := d.Object(bucket, name)
+	return string(data), ok
+}
+
+// gets counts the downloads so far.
+func (d *fakeDaemon) gets() int {
+	n := 0
+	for _, cmd := range d.Calls() {
+		if cmd == "lfs/get_object" {
+			n++
+		}
+	}
+	return n
+}
+
+// failPuts makes uploads fail, or work again.
+func (d *fakeDaemon) failPuts(fail bool) {
+	if !fail {
+		d.Handle("lfs/put_object", nil)
+		return
+	}
+	d.Handle("lfs/put_object", func(w http.ResponseWriter, r *http.Request) {
+		fakedaemon.Error(w, "disk full")
+	})
+}
+
+func newTestMount(t *testing.T) (*mount, *fakeDaemon, func()) {
+	d := &fakeDaemon{fakedaemon.New()}
+	dir, err := ioutil.TempDir("", "mefs-mount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newMount(d.Shell(), dir), d, func() {
+		d.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func names(ents []entry) []string {
+	var ns []string
+	for _, e := range ents {
+		n := e.name
+		if e.dir {
+			n += "/"
+		}
+		ns = append(ns, n)
+	}
+	return ns
+}
+
+func writeFile(m *mount, p, data string) error {
+	h, err := m.open(p, true, true, true)
+	if err != nil {
+		return err
+	}
+	if _, err := h.writeAt([]byte(data), 0); err != nil {
+		return err
+	}
+	if err := h.flush(); err != nil {
+		return err
+	}
+	return h.release()
+}
+
+func TestMountReadDirAndStat(t *testing.T) {
+	is := is.New(t)
+	m, d, done := newTestMount(t)
+	defer done()
+
+	is.NoErr(m.mkdir("/b0"))
+	is.NoErr(m.mkdir("/b1"))
+	is.NoErr(writeFile(m, "/b0/a", "aaa"))
+	is.NoErr(writeFile(m, "/b0/dir/b", "bb"))
+	is.NoErr(writeFile(m, "/b0/dir/sub/c", "c"))
+
+	ents, err := m.readDir("/")
+	is.NoErr(err)
+	is.Equal(names(ents), []string{"b0/", "b1/"})
+	ents, err = m.readDir("/b0")
+	is.NoErr(err)
+	is.Equal(names(ents), []string{"a", "dir/"})
+	ents, err = m.readDir("/b0/dir")
+	is.NoErr(err)
+	is.Equal(names(ents), []string{"b", "sub/"})
+
+	e, err := m.stat("/b0/a")
+	is.NoErr(err)
+	is.False(e.dir)
+	is.Equal(e.size, int64(3))
+	e, err = m.stat("/b0/dir/sub")
+	is.NoErr(err)
+	is.True(e.dir)
+	_, err = m.stat("/b0/missing")
+	is.True(os.IsNotExist(err))
+	_, err = m.stat("/missing")
+	is.True(os.IsNotExist(err))
+
+	data, err := m.readAt("/b0/dir/b", 1, 10)
+	is.NoErr(err)
+	is.Equal(string(data), "b")
+	data, err = m.readAt("/b0/a", 0, 2)
+	is.NoErr(err)
+	is.Equal(string(data), "aa")
+	is.Equal(d.gets(), 2)
+
+	// directories made with mkdir exist until they are removed
+	is.NoErr(m.mkdir("/b1/empty"))
+	ents, err = m.readDir("/b1")
+	is.NoErr(err)
+	is.Equal(names(ents), []string{"empty/"})
+	is.Equal(m.remove("/b0/dir", true), errNotEmpty)
+	is.NoErr(m.remove("/b1/empty", true))
+	_, err = m.stat("/b1/empty")
+	is.True(os.IsNotExist(err))
+	is.NoErr(m.remove("/b1", true))
+	is.Equal(m.remove("/b0", true), errNotEmpty)
+}
+
+func TestMountWriteBack(t *testing.T) {
+	is := is.New(t)
+	m, d, done := newTestMount(t)
+	defer done()
+
+	is.NoErr(m.mkdir("/b0"))
+	h, err := m.open("/b0/f", true, true, true)
+	is.NoErr(err)
+	_, err = h.writeAt([]byte("hello"), 0)
+	is.NoErr(err)
+
+	// not uploaded before it is closed, but visible
+	_, ok := d.object("b0", "f")
+	is.False(ok)
+	e, err := m.stat("/b0/f")
+	is.NoErr(err)
+	is.Equal(e.size, int64(5))
+	ents, err := m.readDir("/b0")
+	is.NoErr(err)
+	is.Equal(names(ents), []string{"f"})
+	data, err := h.readAt(1, 3)
+	is.NoErr(err)
+	is.Equal(string(data), "ell")
+
+	is.NoErr(h.flush())
+	is.NoErr(h.release())
+	got, ok := d.object("b0", "f")
+	is.True(ok)
+	is.Equal(got, "hello")
+	files, err := ioutil.ReadDir(m.tmpDir)
+	is.NoErr(err)
+	is.Equal(len(files), 0)
+
+	// writing into an object replaces it
+	h, err = m.open("/b0/f", true, false, false)
+	is.NoErr(err)
+	_, err = h.writeAt([]byte(", world"), 5)
+	is.NoErr(err)
+	is.NoErr(h.release())
+	got, _ = d.object("b0", "f")
+	is.Equal(got, "hello, world")
+
+	is.NoErr(m.truncate("/b0/f", 4))
+	got, _ = d.object("b0", "f")
+	is.Equal(got, "hell")
+	_, ok = d.object("b0", "f"+uploadSuffix)
+	is.False(ok)
+
+	// only create makes a file
+	is.Equal(m.truncate("/b0/none", 0), os.ErrNotExist)
+	is.Equal(m.truncate("/b0/none", 4), os.ErrNotExist)
+	_, err = m.open("/b0/none", true, false, false)
+	is.Equal(err, os.ErrNotExist)
+	_, ok = d.object("b0", "none")
+	is.False(ok)
+
+	// a failed upload leaves the old object alone
+	h, err = m.open("/b0/f", true, false, false)
+	is.NoErr(err)
+	_, err = h.writeAt([]byte("o"), 4)
+	is.NoErr(err)
+	d.failPuts(true)
+	is.Err(h.release())
+	d.failPuts(false)
+	got, _ = d.object("b0", "f")
+	is.Equal(got, "hell")
+	_, ok = d.object("b0", "f"+uploadSuffix)
+	is.False(ok)
+
+	// nothing is uploaded for a file that was only read
+	h, err = m.open("/b0/f", false, false, false)
+	is.NoErr(err)
+	_, err = h.writeAt([]byte("x"), 0)
+	is.Err(err)
+	is.NoErr(h.release())
+	got, _ = d.object("b0", "f")
+	is.Equal(got, "hell")
+
+	// a file removed while open is not uploaded on close
+	h, err = m.open("/b0/g", true, true, true)
+	is.NoErr(err)
+	is.NoErr(m.remove("/b0/g", false))
+	is.NoErr(h.release())
+	_, ok = d.object("b0", "g")
+	is.False(ok)
+}
+
+func TestMountFailedReplace(t *testing.T) {
+	is := is.New(t)
+	m, d, done := newTestMount(t)
+	defer done()
+
+	is.NoErr(m.mkdir("/b0"))
+	is.NoErr(writeFile(m, "/b0/f", "old"))
+
+	// the new data is uploaded, but moving it over the old object fails
+	// once the old one is gone
+	d.Handle("lfs/put_object", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query()["arg"][1] == "f" {
+			fakedaemon.Error(w, "disk full")
+			return
+		}
+		d.Builtin(w, r)
+	})
+	h, err := m.open("/b0/f", true, true, false)
+	is.NoErr(err)
+	_, err = h.writeAt([]byte("new"), 0)
+	is.NoErr(err)
+	is.Err(h.release())
+	d.Handle("lfs/put_object", nil)
+
+	// the upload object holds the data and is no longer hidden
+	_, ok := d.object("b0", "f")
+	is.False(ok)
+	got, ok := d.object("b0", "f"+uploadSuffix)
+	is.True(ok)
+	is.Equal(got, "new")
+	ents, err := m.readDir("/b0")
+	is.NoErr(err)
+	is.Equal(names(ents), []string{"f" + uploadSuffix})
+	data, err := m.readAt("/b0/f"+uploadSuffix, 0, 10)
+	is.NoErr(err)
+	is.Equal(string(data), "new")
+}
+
+func TestMountRename(t *testing.T) {
+	is := is.New(t)
+	m, d, done := newTestMount(t)
+	defer done()
+
+	is.NoErr(m.mkdir("/b0"))
+	is.NoErr(writeFile(m, "/b0/a", "a"))
+	is.NoErr(writeFile(m, "/b0/x", "x"))
+	is.NoErr(writeFile(m, "/b0/dir/b", "b"))
+	is.NoErr(writeFile(m, "/b0/dir/c", "c"))
+
+	// replaces x
+	is.NoErr(m.rename("/b0/a", "/b0/x"))
+	_, ok := d.object("b0", "a")
+	is.False(ok)
+	got, _ := d.object("b0", "x")
+	is.Equal(got, "a")
+
+	is.NoErr(m.rename("/b0/dir", "/b0/moved"))
+	ents, err := m.readDir("/b0")
+	is.NoErr(err)
+	is.Equal(names(ents), []string{"moved/", "x"})
+	got, _ = d.object("b0", "moved/c")
+	is.Equal(got, "c")
+
+	is.Equal(m.rename("/b0", "/b1"), errNotSupported)
+}
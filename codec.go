@@ -0,0 +1,885 @@
+package shell
+
+import (
+	"bufio"
+	"encoding"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Codec decodes the responses of the daemon in one of the encodings it
+// supports. Pick one for a Shell with SetCodec, or for a single call with
+// UseCodec.
+type Codec interface {
+	// Name is sent as the encoding option of requests.
+	Name() string
+	// ContentType is the MIME type of the daemon's responses.
+	ContentType() string
+	NewDecoder(r io.Reader) Decoder
+}
+
+// Decoder reads values one after the other from a response. Decode
+// returns io.EOF when there is no value left.
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+var (
+	// JSONCodec is the default codec.
+	JSONCodec Codec = jsonCodec{}
+	// CBORCodec decodes CBOR responses into the same types as JSONCodec,
+	// honouring their JSON field names. The types of this package decode
+	// straight from CBOR; other UnmarshalJSON methods get the item as JSON.
+	CBORCodec Codec = cborCodec{}
+)
+
+// maxCodecItem bounds the strings a binary codec allocates for, so a
+// corrupt length can not exhaust memory.
+const maxCodecItem = 64 << 20
+
+// maxCodecDepth bounds how deeply the items of a response may nest, so a
+// hostile one can not exhaust the stack.
+const maxCodecDepth = 10000
+
+// UseCodec makes a single call use codec instead of the Shell's.
+func UseCodec(codec Codec) LfsOpts {
+	return func(rb *RequestBuilder) error {
+		if codec == nil {
+			return errors.New("no codec given")
+		}
+		rb.Codec(codec)
+		return nil
+	}
+}
+
+// SetCodec sets the codec used for the responses of the daemon. A command
+// the daemon can not answer in codec is sent again with JSONCodec, and keeps
+// to JSON until the next SetCodec. Uploads, whose body can not be sent
+// twice, keep to JSON unless UseCodec asks otherwise.
+func (s *Shell) SetCodec(codec Codec) {
+	s.codecMu.Lock()
+	defer s.codecMu.Unlock()
+	s.codec = codec
+	s.jsonOnly = nil
+}
+
+// codecFor returns the Shell's codec for command, or nil for the default.
+func (s *Shell) codecFor(command string) Codec {
+	s.codecMu.RLock()
+	defer s.codecMu.RUnlock()
+	if s.jsonOnly[command] {
+		return nil
+	}
+	return s.codec
+}
+
+// rejectCodec makes command keep to JSON, unless the codec it rejected was
+// replaced meanwhile.
+func (s *Shell) rejectCodec(command string, codec Codec) {
+	s.codecMu.Lock()
+	defer s.codecMu.Unlock()
+	if s.codec != codec {
+		return
+	}
+	if s.jsonOnly == nil {
+		s.jsonOnly = make(map[string]bool)
+	}
+	s.jsonOnly[command] = true
+}
+
+// isCodecRejected reports whether the daemon refused to answer in the
+// encoding a request asked for.
+func isCodecRejected(e *Error) bool {
+	return e != nil && strings.Contains(strings.ToLower(e.Message), "encoding")
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string        { return "json" }
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) NewDecoder(r io.Reader) Decoder {
+	return json.NewDecoder(r)
+}
+
+type cborCodec struct{}
+
+func (cborCodec) Name() string        { return "cbor" }
+func (cborCodec) ContentType() string { return "application/cbor" }
+
+func (cborCodec) NewDecoder(r io.Reader) Decoder {
+	return &cborDecoder{r: bufio.NewReader(r)}
+}
+
+var errCBORBreak = errors.New("cbor: unexpected break")
+
+type cborDecoder struct {
+	r     *bufio.Reader
+	depth int
+}
+
+// cborUnmarshaler is implemented by the types of this package that need
+// more than their fields decoded, in place of their UnmarshalJSON.
+type cborUnmarshaler interface {
+	unmarshalCBOR(d *cborDecoder) error
+}
+
+// cborItem keeps an item as it was read, for fields that may come as more
+// than one type.
+type cborItem struct {
+	v interface{}
+}
+
+func (it *cborItem) unmarshalCBOR(d *cborDecoder) (err error) {
+	it.v, err = d.item()
+	return err
+}
+
+// cborText returns the text of a number or a string item, for the fields
+// the daemon sends either way.
+func cborText(it interface{}) (string, bool) {
+	switch it := it.(type) {
+	case string:
+		return it, true
+	case uint64:
+		return strconv.FormatUint(it, 10), true
+	case int64:
+		return strconv.FormatInt(it, 10), true
+	case float64:
+		return strconv.FormatFloat(it, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+// into decodes the next item into the value v points to.
+func (d *cborDecoder) into(v interface{}) error {
+	return d.value(reflect.ValueOf(v).Elem())
+}
+
+func (d *cborDecoder) enter() error {
+	if d.depth++; d.depth > maxCodecDepth {
+		return errors.New("cbor: items nest too deeply")
+	}
+	return nil
+}
+
+// Decode reads a CBOR item and stores it in v the way encoding/json stores
+// the matching JSON document: struct fields are matched by their JSON names,
+// and values decoded into interface{} hold float64 for numbers.
+func (d *cborDecoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("cbor: can not decode into %T", v)
+	}
+	if _, err := d.r.Peek(1); err != nil {
+		return err
+	}
+	d.depth = 0
+	err := d.value(rv.Elem())
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// value decodes the next item into v.
+func (d *cborDecoder) value(v reflect.Value) error {
+	defer func() { d.depth-- }()
+	if err := d.enter(); err != nil {
+		return err
+	}
+	b, err := d.r.Peek(1)
+	if err != nil {
+		return err
+	}
+	switch {
+	case b[0] == 0xf6 || b[0] == 0xf7:
+		// null and undefined
+		d.r.ReadByte()
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	case b[0] == 0xff:
+		d.r.ReadByte()
+		return errCBORBreak
+	case b[0]>>5 == 6:
+		// tags only qualify the item that follows
+		d.r.ReadByte()
+		if _, err := d.arg(b[0] & 0x1f); err != nil {
+			return err
+		}
+		return d.value(v)
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.value(v.Elem())
+	}
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(cborUnmarshaler); ok {
+			return u.unmarshalCBOR(d)
+		}
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(jsonUnmarshalerType) {
+		// such types only say how to read themselves from JSON
+		it, err := d.item()
+		if err != nil {
+			return err
+		}
+		buf, err := json.Marshal(it)
+		if err != nil {
+			return fmt.Errorf("cbor: %s", err)
+		}
+		return v.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(buf)
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		it, err := d.item()
+		if err != nil {
+			return err
+		}
+		if it = generic(it); it == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(it))
+		}
+		return nil
+	}
+
+	head, _ := d.r.ReadByte()
+	major, info := head>>5, head&0x1f
+	if major == 7 {
+		return d.simpleValue(info, v)
+	}
+	if info == 31 {
+		return d.indefiniteValue(major, v)
+	}
+	n, err := d.arg(info)
+	if err != nil {
+		return err
+	}
+
+	switch major {
+	case 0:
+		return setNumber(v, n)
+	case 1:
+		if n > math.MaxInt64 {
+			return setNumber(v, -1-float64(n))
+		}
+		return setNumber(v, -1-int64(n))
+	case 2:
+		b, err := d.bytes(n)
+		if err != nil {
+			return err
+		}
+		return setBytes(v, b)
+	case 3:
+		b, err := d.bytes(n)
+		if err != nil {
+			return err
+		}
+		return setString(v, string(b))
+	case 4:
+		return d.array(v, int64(minInt(n, math.MaxInt32)))
+	default:
+		return d.object(v, int64(minInt(n, math.MaxInt32)))
+	}
+}
+
+func (d *cborDecoder) simpleValue(info byte, v reflect.Value) error {
+	it, err := d.simple(info)
+	if err != nil {
+		return err
+	}
+	switch it := it.(type) {
+	case bool:
+		if v.Kind() != reflect.Bool {
+			return &json.UnmarshalTypeError{Value: "bool", Type: v.Type()}
+		}
+		v.SetBool(it)
+		return nil
+	case float64:
+		return setNumber(v, it)
+	}
+	return nil
+}
+
+func (d *cborDecoder) indefiniteValue(major byte, v reflect.Value) error {
+	switch major {
+	case 2, 3:
+		it, err := d.indefinite(major)
+		if err != nil {
+			return err
+		}
+		if b, ok := it.([]byte); ok {
+			return setBytes(v, b)
+		}
+		return setString(v, it.(string))
+	case 4:
+		return d.array(v, -1)
+	case 5:
+		return d.object(v, -1)
+	default:
+		return fmt.Errorf("cbor: major type %d can not be indefinite", major)
+	}
+}
+
+// more tells whether the ith element of an array or map of n elements, or
+// of an indefinite one if n is negative, follows.
+func (d *cborDecoder) more(i, n int64) (bool, error) {
+	if n >= 0 {
+		return i < n, nil
+	}
+	b, err := d.r.Peek(1)
+	if err != nil {
+		return false, err
+	}
+	if b[0] == 0xff {
+		d.r.ReadByte()
+		return false, nil
+	}
+	return true, nil
+}
+
+func (d *cborDecoder) array(v reflect.Value, n int64) error {
+	var typeErr error
+	switch v.Kind() {
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 0, minInt(uint64(n), 1024)))
+	case reflect.Array:
+	default:
+		typeErr = &json.UnmarshalTypeError{Value: "array", Type: v.Type()}
+	}
+	skip := typeErr != nil
+
+	var i int64
+	for ; ; i++ {
+		ok, err := d.more(i, n)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		switch {
+		case skip || (v.Kind() == reflect.Array && i >= int64(v.Len())):
+			_, err = d.item()
+		case v.Kind() == reflect.Slice:
+			elem := reflect.New(v.Type().Elem()).Elem()
+			err = d.value(elem)
+			v.Set(reflect.Append(v, elem))
+		default:
+			err = d.value(v.Index(int(i)))
+		}
+		if err = keepGoing(err, &typeErr); err == errCBORBreak {
+			return errors.New("cbor: unexpected break")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if v.Kind() == reflect.Array {
+		for ; i < int64(v.Len()); i++ {
+			v.Index(int(i)).Set(reflect.Zero(v.Type().Elem()))
+		}
+	}
+	return typeErr
+}
+
+func (d *cborDecoder) object(v reflect.Value, n int64) error {
+	var (
+		fields  []cborField
+		typeErr error
+	)
+	switch {
+	case v.Kind() == reflect.Struct:
+		fields = cachedFields(v.Type())
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+	default:
+		typeErr = &json.UnmarshalTypeError{Value: "object", Type: v.Type()}
+	}
+	skip := typeErr != nil
+
+	for i := int64(0); ; i++ {
+		ok, err := d.more(i, n)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return typeErr
+		}
+		k, err := d.item()
+		if err != nil {
+			return err
+		}
+		key, ok := k.(string)
+		if !ok {
+			key = fmt.Sprint(k)
+		}
+
+		switch {
+		case skip:
+			_, err = d.item()
+		case v.Kind() == reflect.Struct:
+			if f := findField(fields, key); f != nil {
+				err = d.value(fieldByIndex(v, f.index))
+			} else {
+				_, err = d.item()
+			}
+		default:
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err = d.value(elem); err == nil {
+				v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+			}
+		}
+		if err = keepGoing(err, &typeErr); err == errCBORBreak {
+			return errors.New("cbor: map key without value")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// keepGoing records the first value of the wrong type in typeErr and goes
+// on with the others, as encoding/json does, which also keeps the decoder
+// in step with the stream.
+func keepGoing(err error, typeErr *error) error {
+	if _, ok := err.(*json.UnmarshalTypeError); ok {
+		if *typeErr == nil {
+			*typeErr = err
+		}
+		return nil
+	}
+	return err
+}
+
+func setNumber(v reflect.Value, num interface{}) error {
+	var f float64
+	switch n := num.(type) {
+	case uint64:
+		f = float64(n)
+	case int64:
+		f = float64(n)
+	case float64:
+		f = n
+	}
+	mismatch := &json.UnmarshalTypeError{Value: "number " + fmt.Sprint(num), Type: v.Type()}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch n := num.(type) {
+		case uint64:
+			if n > math.MaxInt64 {
+				return mismatch
+			}
+			i = int64(n)
+		case int64:
+			i = n
+		case float64:
+			if n != math.Trunc(n) || n < math.MinInt64 || n >= math.MaxInt64 {
+				return mismatch
+			}
+			i = int64(n)
+		}
+		if v.OverflowInt(i) {
+			return mismatch
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch n := num.(type) {
+		case uint64:
+			u = n
+		case int64:
+			if n < 0 {
+				return mismatch
+			}
+			u = uint64(n)
+		case float64:
+			if n != math.Trunc(n) || n < 0 || n >= math.MaxUint64 {
+				return mismatch
+			}
+			u = uint64(n)
+		}
+		if v.OverflowUint(u) {
+			return mismatch
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		if v.OverflowFloat(f) {
+			return mismatch
+		}
+		v.SetFloat(f)
+	default:
+		return mismatch
+	}
+	return nil
+}
+
+func setBytes(v reflect.Value, b []byte) error {
+	switch {
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		v.SetBytes(b)
+	case v.Kind() == reflect.String:
+		v.SetString(string(b))
+	default:
+		return &json.UnmarshalTypeError{Value: "bytes", Type: v.Type()}
+	}
+	return nil
+}
+
+func setString(v reflect.Value, s string) error {
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	switch {
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		// as encoding/json has it
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return err
+		}
+		v.SetBytes(b)
+	default:
+		return &json.UnmarshalTypeError{Value: "string", Type: v.Type()}
+	}
+	return nil
+}
+
+// generic turns the numbers of an item into float64, as encoding/json
+// decodes them into interface{}.
+func generic(it interface{}) interface{} {
+	switch it := it.(type) {
+	case uint64:
+		return float64(it)
+	case int64:
+		return float64(it)
+	case []interface{}:
+		for i := range it {
+			it[i] = generic(it[i])
+		}
+	case map[string]interface{}:
+		for k, v := range it {
+			it[k] = generic(v)
+		}
+	}
+	return it
+}
+
+// cborField is a struct field as encoding/json names it.
+type cborField struct {
+	name  string
+	index []int
+}
+
+var cborFieldCache sync.Map
+
+func cachedFields(t reflect.Type) []cborField {
+	if fs, ok := cborFieldCache.Load(t); ok {
+		return fs.([]cborField)
+	}
+	fs := structFields(t, nil)
+	cborFieldCache.Store(t, fs)
+	return fs
+}
+
+// structFields lists the fields of t, those of embedded structs after the
+// others so the outer ones win.
+func structFields(t reflect.Type, index []int) []cborField {
+	var fields, embedded []cborField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		idx := append(index[:len(index):len(index)], i)
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			embedded = append(embedded, structFields(ft, idx)...)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, cborField{name: name, index: idx})
+	}
+	return append(fields, embedded...)
+}
+
+func findField(fields []cborField, key string) *cborField {
+	for i := range fields {
+		if fields[i].name == key {
+			return &fields[i]
+		}
+	}
+	for i := range fields {
+		if strings.EqualFold(fields[i].name, key) {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex, allocating the embedded
+// structs it goes through if they are nil pointers.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func (d *cborDecoder) item() (interface{}, error) {
+	defer func() { d.depth-- }()
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	major, info := b>>5, b&0x1f
+	if major == 7 {
+		return d.simple(info)
+	}
+	if info == 31 {
+		return d.indefinite(major)
+	}
+	n, err := d.arg(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		return n, nil
+	case 1:
+		if n > math.MaxInt64 {
+			return -1 - float64(n), nil
+		}
+		return -1 - int64(n), nil
+	case 2:
+		return d.bytes(n)
+	case 3:
+		b, err := d.bytes(n)
+		return string(b), err
+	case 4:
+		arr := make([]interface{}, 0, minInt(n, 1024))
+		for i := uint64(0); i < n; i++ {
+			it, err := d.item()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, it)
+		}
+		return arr, nil
+	case 5:
+		m := make(map[string]interface{}, minInt(n, 1024))
+		for i := uint64(0); i < n; i++ {
+			if err := d.pair(m); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	default:
+		// tags only qualify the item that follows
+		return d.item()
+	}
+}
+
+func (d *cborDecoder) indefinite(major byte) (interface{}, error) {
+	switch major {
+	case 2, 3:
+		var buf []byte
+		for {
+			chunk, err := d.item()
+			if err == errCBORBreak {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			switch c := chunk.(type) {
+			case []byte:
+				buf = append(buf, c...)
+			case string:
+				buf = append(buf, c...)
+			default:
+				return nil, errors.New("cbor: invalid chunk in indefinite string")
+			}
+		}
+		if major == 3 {
+			return string(buf), nil
+		}
+		return buf, nil
+	case 4:
+		var arr []interface{}
+		for {
+			it, err := d.item()
+			if err == errCBORBreak {
+				return arr, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, it)
+		}
+	case 5:
+		m := make(map[string]interface{})
+		for {
+			if err := d.pair(m); err == errCBORBreak {
+				return m, nil
+			} else if err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("cbor: major type %d can not be indefinite", major)
+	}
+}
+
+func (d *cborDecoder) pair(m map[string]interface{}) error {
+	k, err := d.item()
+	if err != nil {
+		return err
+	}
+	v, err := d.item()
+	if err == errCBORBreak {
+		return errors.New("cbor: map key without value")
+	}
+	if err != nil {
+		return err
+	}
+	if s, ok := k.(string); ok {
+		m[s] = v
+	} else {
+		m[fmt.Sprint(k)] = v
+	}
+	return nil
+}
+
+func (d *cborDecoder) simple(info byte) (interface{}, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		n, err := d.arg(info)
+		return halfFloat(uint16(n)), err
+	case 26:
+		n, err := d.arg(info)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 27:
+		n, err := d.arg(info)
+		return math.Float64frombits(n), err
+	case 31:
+		return nil, errCBORBreak
+	default:
+		return nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+	}
+}
+
+func (d *cborDecoder) arg(info byte) (uint64, error) {
+	var size int
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, fmt.Errorf("cbor: invalid additional information %d", info)
+	}
+	var buf [8]byte
+	if _, err := io.ReadFull(d.r, buf[8-size:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func (d *cborDecoder) bytes(n uint64) ([]byte, error) {
+	if n > maxCodecItem {
+		return nil, fmt.Errorf("cbor: string of %d bytes is too long", n)
+	}
+	buf := make([]byte, n)
+	_, err := io.ReadFull(d.r, buf)
+	return buf, err
+}
+
+func halfFloat(h uint16) float64 {
+	exp, mant := int(h>>10&0x1f), float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+func minInt(n uint64, max int) int {
+	if n < uint64(max) {
+		return int(n)
+	}
+	return max
+}
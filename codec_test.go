@@ -0,0 +1,335 @@
+package shell
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+	"github.com/xcshuan/go-mefs-api/internal/fakedaemon"
+)
+
+// cborEncode is a minimal CBOR encoder for building fake responses.
+func cborEncode(buf *bytes.Buffer, v interface{}) {
+	head := func(major byte, n uint64) {
+		switch {
+		case n < 24:
+			buf.WriteByte(major<<5 | byte(n))
+		case n <= math.MaxUint8:
+			buf.WriteByte(major<<5 | 24)
+			buf.WriteByte(byte(n))
+		case n <= math.MaxUint16:
+			buf.WriteByte(major<<5 | 25)
+			binary.Write(buf, binary.BigEndian, uint16(n))
+		case n <= math.MaxUint32:
+			buf.WriteByte(major<<5 | 26)
+			binary.Write(buf, binary.BigEndian, uint32(n))
+		default:
+			buf.WriteByte(major<<5 | 27)
+			binary.Write(buf, binary.BigEndian, n)
+		}
+	}
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+	case bool:
+		if v {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case int:
+		if v < 0 {
+			head(1, uint64(-1-v))
+		} else {
+			head(0, uint64(v))
+		}
+	case float64:
+		buf.WriteByte(0xfb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case string:
+		head(3, uint64(len(v)))
+		buf.WriteString(v)
+	case []byte:
+		head(2, uint64(len(v)))
+		buf.Write(v)
+	case []interface{}:
+		head(4, uint64(len(v)))
+		for _, it := range v {
+			cborEncode(buf, it)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		head(5, uint64(len(keys)))
+		for _, k := range keys {
+			cborEncode(buf, k)
+			cborEncode(buf, v[k])
+		}
+	default:
+		panic("cborEncode: unsupported type")
+	}
+}
+
+func TestCBORDecoder(t *testing.T) {
+	is := is.New(t)
+
+	var buf bytes.Buffer
+	cborEncode(&buf, map[string]interface{}{
+		"Name":  "a",
+		"Size":  1 << 40,
+		"Neg":   -3,
+		"Ratio": 0.5,
+		"Ok":    true,
+		"Raw":   []byte("hi"),
+		"List":  []interface{}{1, "two", nil},
+	})
+	// an indefinite map holding an indefinite string, then a half float
+	buf.Write([]byte{0xbf, 0x64, 'N', 'a', 'm', 'e', 0x7f, 0x62, 'a', 'b', 0x61, 'c', 0xff, 0xff})
+	buf.Write([]byte{0xf9, 0x3e, 0x00})
+
+	var rec struct {
+		Name  string
+		Size  int64
+		Neg   int
+		Ratio float64
+		Ok    bool
+		Raw   []byte
+		List  []interface{}
+	}
+	dec := CBORCodec.NewDecoder(&buf)
+	is.NoErr(dec.Decode(&rec))
+	is.Equal(rec.Name, "a")
+	is.Equal(rec.Size, int64(1<<40))
+	is.Equal(rec.Neg, -3)
+	is.Equal(rec.Ratio, 0.5)
+	is.True(rec.Ok)
+	is.Equal(rec.Raw, []byte("hi"))
+	is.Equal(rec.List, []interface{}{float64(1), "two", nil})
+
+	var named struct{ Name string }
+	is.NoErr(dec.Decode(&named))
+	is.Equal(named.Name, "abc")
+
+	var f float64
+	is.NoErr(dec.Decode(&f))
+	is.Equal(f, 1.5)
+
+	is.Equal(dec.Decode(&f), io.EOF)
+
+	// truncated input
+	dec = CBORCodec.NewDecoder(bytes.NewReader([]byte{0x82, 0x01}))
+	is.Equal(dec.Decode(&rec.List), io.ErrUnexpectedEOF)
+}
+
+type cborInner struct {
+	Depth int
+}
+
+func TestCBORDecoderTypes(t *testing.T) {
+	is := is.New(t)
+
+	var buf bytes.Buffer
+	cborEncode(&buf, map[string]interface{}{
+		"name":    "tagged",
+		"Skipped": "x",
+		"Depth":   2,
+		"Counts":  map[string]interface{}{"a": 1, "b": 2},
+		"Ptr":     map[string]interface{}{"Depth": 3},
+		"Pair":    []interface{}{1, 2, 3},
+		"Ctime":   "2019-03-04 05:06:07 UTC",
+		"Unknown": []interface{}{map[string]interface{}{"x": nil}},
+	})
+	cborEncode(&buf, map[string]interface{}{"Depth": "deep", "name": "after"})
+	cborEncode(&buf, map[string]interface{}{"Depth": 1.5})
+	cborEncode(&buf, []interface{}{"not", "an", "object"})
+
+	type rec struct {
+		cborInner
+		Label   string `json:"name"`
+		Skipped string `json:"-"`
+		Counts  map[string]int
+		Ptr     *cborInner
+		Pair    [2]uint8
+		Ctime   Time
+	}
+	var r rec
+	dec := CBORCodec.NewDecoder(&buf)
+	is.NoErr(dec.Decode(&r))
+	is.Equal(r.Label, "tagged")
+	is.Equal(r.Skipped, "")
+	is.Equal(r.Depth, 2)
+	is.Equal(r.Counts, map[string]int{"a": 1, "b": 2})
+	is.Equal(r.Ptr.Depth, 3)
+	is.Equal(r.Pair, [2]uint8{1, 2})
+	is.Equal(r.Ctime.Raw, "2019-03-04 05:06:07 UTC")
+	is.Equal(r.Ctime.Year(), 2019)
+
+	// mismatches fail like they do with encoding/json, and leave the
+	// decoder at the next value
+	for i := 0; i < 3; i++ {
+		var r rec
+		err := dec.Decode(&r)
+		_, ok := err.(*json.UnmarshalTypeError)
+		is.True(ok)
+		if i == 0 {
+			is.Equal(r.Label, "after")
+		}
+	}
+	is.Equal(dec.Decode(&r), io.EOF)
+}
+
+func TestCBORObjectStat(t *testing.T) {
+	is := is.New(t)
+
+	var buf bytes.Buffer
+	cborEncode(&buf, map[string]interface{}{
+		"Objects": []interface{}{
+			map[string]interface{}{
+				"ObjectName": "a",
+				"ObjectSize": 1 << 60,
+				"Ctime":      1551675967,
+				// encoding/json can not write NaN, so decoding this
+				// through JSON would fail
+				"Score": math.NaN(),
+			},
+			map[string]interface{}{"ObjectName": "b", "ObjectSize": "123", "Ctime": "soon"},
+			map[string]interface{}{"ObjectName": "c", "ObjectSize": nil},
+		},
+	})
+	var objs Objects
+	is.NoErr(CBORCodec.NewDecoder(&buf).Decode(&objs))
+	is.Equal(len(objs.Objects), 3)
+	is.Equal(objs.Objects[0].ObjectSize, int64(1<<60))
+	is.Equal(objs.Objects[0].Ctime.Unix(), int64(1551675967))
+	is.Equal(objs.Objects[1].ObjectSize, int64(123))
+	is.Equal(objs.Objects[1].Ctime.Raw, "soon")
+	is.True(objs.Objects[1].Ctime.IsZero())
+	is.Equal(objs.Objects[2].ObjectSize, int64(0))
+
+	buf.Reset()
+	cborEncode(&buf, map[string]interface{}{"ObjectSize": "big"})
+	var ob ObjectStat
+	is.Err(CBORCodec.NewDecoder(&buf).Decode(&ob))
+
+	// nesting is bounded rather than left to the stack
+	buf.Reset()
+	buf.Write(bytes.Repeat([]byte{0x81}, maxCodecDepth+1))
+	buf.WriteByte(0x01)
+	var v interface{}
+	is.Err(CBORCodec.NewDecoder(bytes.NewReader(buf.Bytes())).Decode(&v))
+	var nested []interface{}
+	is.Err(CBORCodec.NewDecoder(&buf).Decode(&nested))
+}
+
+func TestCodecListObjects(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	d.Handle("lfs/list_objects", func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.URL.Query().Get("encoding"), "cbor")
+		var buf bytes.Buffer
+		cborEncode(&buf, map[string]interface{}{
+			"Method": "List Objects",
+			"Objects": []interface{}{
+				map[string]interface{}{"ObjectName": "a", "ObjectSize": 3, "Ctime": "2019-03-04 05:06:07"},
+			},
+		})
+		w.Header().Set("Content-Type", "application/cbor")
+		w.Write(buf.Bytes())
+	})
+	d.Handle("lfs/head_object", func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.URL.Query().Get("encoding"), "json")
+		fakedaemon.Error(w, "object not exist")
+	})
+
+	s.SetCodec(CBORCodec)
+	objs, err := s.ListObjects("b0")
+	is.NoErr(err)
+	is.Equal(len(objs.Objects), 1)
+	is.Equal(objs.Objects[0].ObjectName, "a")
+	is.Equal(objs.Objects[0].ObjectSize, int64(3))
+	is.Equal(objs.Objects[0].Ctime.Year(), 2019)
+
+	// a single call can go back to JSON
+	_, err = s.HeadObject("a", "b0", UseCodec(JSONCodec))
+	is.Err(err)
+	is.Equal(err.(*Error).Message, "object not exist")
+
+	d.Handle("lfs/head_object", func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		cborEncode(&buf, map[string]interface{}{"Message": "object not exist", "Code": 0})
+		w.Header().Set("Content-Type", "application/cbor")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(buf.Bytes())
+	})
+	_, err = s.HeadObject("a", "b0")
+	is.Err(err)
+	is.Equal(err.(*Error).Message, "object not exist")
+}
+
+func TestCodecFallback(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+	d.Put("b0", "a", []byte("abc"), time.Now())
+
+	var mu sync.Mutex
+	var encodings []string
+	d.Handle("lfs/head_object", func(w http.ResponseWriter, r *http.Request) {
+		enc := r.URL.Query().Get("encoding")
+		mu.Lock()
+		encodings = append(encodings, enc)
+		mu.Unlock()
+		if enc != "json" {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid encoding: " + enc))
+			return
+		}
+		d.Builtin(w, r)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.SetCodec(CBORCodec)
+		}()
+	}
+	wg.Wait()
+
+	// the command is sent again in JSON, and keeps to it
+	objs, err := s.HeadObject("a", "b0")
+	is.NoErr(err)
+	is.Equal(objs.Objects[0].ObjectSize, int64(3))
+	_, err = s.HeadObject("a", "b0")
+	is.NoErr(err)
+	is.Equal(encodings, []string{"cbor", "json", "json"})
+
+	// a codec asked for explicitly is not replaced
+	_, err = s.HeadObject("a", "b0", UseCodec(CBORCodec))
+	is.Err(err)
+	is.True(isCodecRejected(err.(*Error)))
+
+	// a new codec is tried again
+	encodings = nil
+	s.SetCodec(CBORCodec)
+	_, err = s.HeadObject("a", "b0")
+	is.NoErr(err)
+	is.Equal(encodings, []string{"cbor", "json"})
+}
@@ -0,0 +1,19 @@
+package shell
+
+import (
+	"github.com/xcshuan/go-mefs-api/internal/fakedaemon"
+)
+
+// fakeDaemon is an in-memory stand-in for the lfs commands of a mefs daemon.
+// Tests can register extra commands with Handle.
+type fakeDaemon struct {
+	*fakedaemon.Daemon
+}
+
+func newFakeDaemon() *fakeDaemon {
+	return &fakeDaemon{fakedaemon.New()}
+}
+
+func (d *fakeDaemon) Shell() *Shell {
+	return NewShell(d.URL)
+}
@@ -0,0 +1,159 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+type PeerInfo struct {
+	Addrs []string
+	ID    string
+}
+
+// QueryEventType is the kind of a DHT query event.
+type QueryEventType int
+
+// The values match the daemon's routing query events.
+const (
+	SendingQuery QueryEventType = iota
+	PeerResponse
+	FinalPeer
+	QueryError
+	Provider
+	Value
+	AddingPeer
+	DialingPeer
+)
+
+var queryEventNames = []string{
+	"SendingQuery",
+	"PeerResponse",
+	"FinalPeer",
+	"QueryError",
+	"Provider",
+	"Value",
+	"AddingPeer",
+	"DialingPeer",
+}
+
+func (t QueryEventType) String() string {
+	if t >= 0 && int(t) < len(queryEventNames) {
+		return queryEventNames[t]
+	}
+	return fmt.Sprintf("QueryEventType(%d)", int(t))
+}
+
+// QueryEvent is one step of a DHT query. ID is the peer the event is about;
+// Extra holds the value for Value events and the message for QueryError
+// events.
+type QueryEvent struct {
+	ID        string
+	Type      QueryEventType
+	Responses []PeerInfo
+	Extra     string
+}
+
+func (ev QueryEvent) String() string {
+	return fmt.Sprintf("%s %s %v %s", ev.Type, ev.ID, ev.Responses, ev.Extra)
+}
+
+var errPeerNotFound = errors.New("peer not found")
+
+// FindPeer looks up the addresses of a peer. The QueryErrors of single
+// peers are a normal part of the query; only if the query itself broke off
+// is its error returned instead of errPeerNotFound.
+func (s *Shell) FindPeer(peer string) (*PeerInfo, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := s.dhtQuery(ctx, s.Request("dht/findpeer", peer))
+	if err != nil {
+		return nil, err
+	}
+	var queryErr error
+	for ev := range events {
+		switch ev.Type {
+		case QueryError:
+			// dhtQuery reports a broken stream with no peer
+			if ev.ID == "" {
+				queryErr = errors.New(ev.Extra)
+			}
+		case FinalPeer:
+			for _, pi := range ev.Responses {
+				if pi.ID == peer {
+					return &pi, nil
+				}
+			}
+		}
+	}
+	if queryErr != nil {
+		return nil, queryErr
+	}
+	return nil, errPeerNotFound
+}
+
+// FindProvs looks for up to numProviders peers providing a cid; zero leaves
+// the number to the daemon. The providers arrive in Provider events.
+func (s *Shell) FindProvs(ctx context.Context, cid string, numProviders int) (<-chan QueryEvent, error) {
+	rb := s.Request("dht/findprovs", cid)
+	if numProviders > 0 {
+		rb.Option("num-providers", numProviders)
+	}
+	return s.dhtQuery(ctx, rb)
+}
+
+// Provide announces to the network that the local node provides cid.
+func (s *Shell) Provide(ctx context.Context, cid string, recursive bool) (<-chan QueryEvent, error) {
+	return s.dhtQuery(ctx, s.Request("dht/provide", cid).Option("recursive", recursive))
+}
+
+// Query looks for the peers closest to peer.
+func (s *Shell) Query(ctx context.Context, peer string) (<-chan QueryEvent, error) {
+	return s.dhtQuery(ctx, s.Request("dht/query", peer))
+}
+
+// DhtGet looks up the value of key; it arrives in a Value event.
+func (s *Shell) DhtGet(ctx context.Context, key string) (<-chan QueryEvent, error) {
+	return s.dhtQuery(ctx, s.Request("dht/get", key))
+}
+
+// DhtPut stores value under key in the DHT.
+func (s *Shell) DhtPut(ctx context.Context, key, value string) (<-chan QueryEvent, error) {
+	return s.dhtQuery(ctx, s.Request("dht/put", key, value))
+}
+
+// dhtQuery sends a DHT command and streams its events until the daemon is
+// done or ctx ends. A broken stream ends with a QueryError event with an
+// empty ID.
+func (s *Shell) dhtQuery(ctx context.Context, rb *RequestBuilder) (<-chan QueryEvent, error) {
+	stream, err := rb.Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan QueryEvent)
+	go func() {
+		defer close(ch)
+		defer stream.Close()
+		for {
+			var ev QueryEvent
+			err := stream.Next(&ev)
+			if err != nil {
+				if err == io.EOF || ctx.Err() != nil {
+					return
+				}
+				ev = QueryEvent{Type: QueryError, Extra: err.Error()}
+			}
+			select {
+			case ch <- ev:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
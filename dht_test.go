@@ -0,0 +1,72 @@
+package shell
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/cheekybits/is"
+)
+
+func TestDhtQueryEvents(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	d.Handle("dht/findprovs", func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.URL.Query().Get("num-providers"), "2")
+		enc := json.NewEncoder(w)
+		enc.Encode(QueryEvent{ID: "QmA", Type: SendingQuery})
+		enc.Encode(QueryEvent{Type: Provider, Responses: []PeerInfo{{ID: "QmB"}}})
+		w.Write([]byte("{broken"))
+	})
+
+	events, err := s.FindProvs(context.Background(), "QmCid", 2)
+	is.NoErr(err)
+	var got []QueryEvent
+	for ev := range events {
+		got = append(got, ev)
+	}
+	is.Equal(len(got), 3)
+	is.Equal(got[0].Type, SendingQuery)
+	is.Equal(got[1].Responses[0].ID, "QmB")
+	is.Equal(got[2].Type, QueryError)
+}
+
+func TestFindPeer(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	d.Handle("dht/findpeer", func(w http.ResponseWriter, r *http.Request) {
+		enc := json.NewEncoder(w)
+		enc.Encode(QueryEvent{ID: "QmA", Type: PeerResponse, Responses: []PeerInfo{{ID: "QmX"}}})
+		enc.Encode(QueryEvent{Type: FinalPeer, Responses: []PeerInfo{{ID: "QmTarget", Addrs: []string{"/ip4/1.2.3.4/tcp/1"}}}})
+	})
+
+	pi, err := s.FindPeer("QmTarget")
+	is.NoErr(err)
+	is.Equal(pi.Addrs, []string{"/ip4/1.2.3.4/tcp/1"})
+
+	_, err = s.FindPeer("QmOther")
+	is.Equal(err, errPeerNotFound)
+
+	d.Handle("dht/findpeer", func(w http.ResponseWriter, r *http.Request) {
+		enc := json.NewEncoder(w)
+		enc.Encode(QueryEvent{ID: "QmA", Type: QueryError, Extra: "failed to dial QmA"})
+		enc.Encode(QueryEvent{Type: FinalPeer})
+	})
+	// a peer that could not be dialed is part of the query, not its error
+	_, err = s.FindPeer("QmTarget")
+	is.Equal(err, errPeerNotFound)
+
+	d.Handle("dht/findpeer", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{broken"))
+	})
+	_, err = s.FindPeer("QmTarget")
+	is.Err(err)
+	is.NotEqual(err, errPeerNotFound)
+}
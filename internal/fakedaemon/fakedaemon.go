@@ -0,0 +1,320 @@
+// Package fakedaemon is an in-memory stand-in for the lfs commands of a mefs
+// daemon, for the tests of the shell package and the tools built on it.
+//
+// It does not import the shell package, whose own tests use it, so the
+// answers are built from types of its own that encode like the daemon's.
+package fakedaemon
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeLayout is how the daemon formats times.
+const timeLayout = "2006-01-02 15:04:05 MST"
+
+type object struct {
+	data        []byte
+	ctime       time.Time
+	contentType string
+	metadata    map[string]string
+}
+
+type objectStat struct {
+	ObjectName  string
+	ObjectSize  int64
+	MD5         string
+	Ctime       string
+	ContentType string            `json:",omitempty"`
+	Metadata    map[string]string `json:",omitempty"`
+}
+
+type objects struct {
+	Method  string
+	Objects []objectStat
+}
+
+type bucketStat struct {
+	BucketName  string
+	BucketID    int32
+	Ctime       string
+	Policy      int32
+	DataCount   int32
+	ParityCount int32
+}
+
+type buckets struct {
+	Method  string
+	Buckets []bucketStat
+}
+
+// Daemon serves the lfs commands of a single user from memory. Commands it
+// does not know, move_object among them, are answered with a 404 so that
+// clients fall back.
+type Daemon struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	buckets  map[string]map[string]*object
+	stats    map[string]bucketStat
+	calls    []string
+	handlers map[string]http.HandlerFunc
+}
+
+// New starts a Daemon; Close stops it.
+func New() *Daemon {
+	d := &Daemon{
+		buckets:  make(map[string]map[string]*object),
+		stats:    make(map[string]bucketStat),
+		handlers: make(map[string]http.HandlerFunc),
+	}
+	d.Server = httptest.NewServer(http.HandlerFunc(d.serve))
+	return d
+}
+
+// Handle serves cmd with h instead of the built in command, or again with
+// the built in one if h is nil. It may be called while requests are served.
+func (d *Daemon) Handle(cmd string, h http.HandlerFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if h == nil {
+		delete(d.handlers, cmd)
+		return
+	}
+	d.handlers[cmd] = h
+}
+
+// Calls returns the commands received so far.
+func (d *Daemon) Calls() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.calls...)
+}
+
+// Put stores an object directly, bypassing the API.
+func (d *Daemon) Put(bucket, name string, data []byte, ctime time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.buckets[bucket] == nil {
+		d.buckets[bucket] = make(map[string]*object)
+	}
+	d.buckets[bucket][name] = &object{data: data, ctime: ctime}
+}
+
+// Object returns the content of a stored object.
+func (d *Daemon) Object(bucket, name string) ([]byte, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ob, ok := d.buckets[bucket][name]
+	if !ok {
+		return nil, false
+	}
+	return ob.data, true
+}
+
+func (d *Daemon) serve(w http.ResponseWriter, r *http.Request) {
+	cmd := strings.TrimPrefix(r.URL.Path, "/api/v0/")
+
+	d.mu.Lock()
+	d.calls = append(d.calls, cmd)
+	h, ok := d.handlers[cmd]
+	d.mu.Unlock()
+	if ok {
+		h(w, r)
+		return
+	}
+	d.Builtin(w, r)
+}
+
+// Builtin serves the commands the daemon implements itself; handlers may
+// call it to wrap them.
+func (d *Daemon) Builtin(w http.ResponseWriter, r *http.Request) {
+	cmd := strings.TrimPrefix(r.URL.Path, "/api/v0/")
+	args := r.URL.Query()["arg"]
+
+	switch cmd {
+	case "lfs/create_bucket":
+		d.mu.Lock()
+		if _, ok := d.buckets[args[0]]; ok {
+			d.mu.Unlock()
+			Error(w, "bucket already exists")
+			return
+		}
+		q := r.URL.Query()
+		policy, _ := strconv.Atoi(q.Get("policy"))
+		dataCount, _ := strconv.Atoi(q.Get("datacount"))
+		parityCount, _ := strconv.Atoi(q.Get("paritycount"))
+		stat := bucketStat{
+			BucketName:  args[0],
+			BucketID:    int32(len(d.stats)),
+			Ctime:       time.Now().Format(timeLayout),
+			Policy:      int32(policy),
+			DataCount:   int32(dataCount),
+			ParityCount: int32(parityCount),
+		}
+		d.buckets[args[0]] = make(map[string]*object)
+		d.stats[args[0]] = stat
+		d.mu.Unlock()
+		JSON(w, buckets{Method: "Create Bucket", Buckets: []bucketStat{stat}})
+	case "lfs/head_Bucket":
+		d.mu.Lock()
+		_, ok := d.buckets[args[0]]
+		stat := d.stats[args[0]]
+		d.mu.Unlock()
+		if !ok {
+			Error(w, "bucket not exist")
+			return
+		}
+		stat.BucketName = args[0]
+		JSON(w, buckets{Method: "Head Bucket", Buckets: []bucketStat{stat}})
+	case "lfs/list_buckets":
+		d.mu.Lock()
+		var bks []bucketStat
+		for name := range d.buckets {
+			stat := d.stats[name]
+			stat.BucketName = name
+			bks = append(bks, stat)
+		}
+		d.mu.Unlock()
+		sort.Slice(bks, func(i, j int) bool { return bks[i].BucketName < bks[j].BucketName })
+		JSON(w, buckets{Method: "List Buckets", Buckets: bks})
+	case "lfs/delete_bucket":
+		d.mu.Lock()
+		bucket, ok := d.buckets[args[0]]
+		switch {
+		case !ok:
+			d.mu.Unlock()
+			Error(w, "bucket not exist")
+			return
+		case len(bucket) > 0:
+			d.mu.Unlock()
+			Error(w, "bucket not empty")
+			return
+		}
+		delete(d.buckets, args[0])
+		delete(d.stats, args[0])
+		d.mu.Unlock()
+		JSON(w, buckets{Method: "Delete Bucket", Buckets: []bucketStat{{BucketName: args[0]}}})
+	case "lfs/put_object":
+		mr, err := r.MultipartReader()
+		if err != nil {
+			Error(w, err.Error())
+			return
+		}
+		part, err := mr.NextPart()
+		if err != nil {
+			Error(w, err.Error())
+			return
+		}
+		data, err := ioutil.ReadAll(part)
+		if err != nil {
+			Error(w, err.Error())
+			return
+		}
+		d.mu.Lock()
+		bucket, ok := d.buckets[args[0]]
+		if !ok {
+			d.mu.Unlock()
+			Error(w, "bucket not exist")
+			return
+		}
+		if _, ok := bucket[args[1]]; ok {
+			d.mu.Unlock()
+			Error(w, "object already exists")
+			return
+		}
+		ob := &object{
+			data:        data,
+			ctime:       time.Now(),
+			contentType: r.URL.Query().Get("contenttype"),
+		}
+		if meta := r.URL.Query().Get("metadata"); meta != "" {
+			json.Unmarshal([]byte(meta), &ob.metadata)
+		}
+		bucket[args[1]] = ob
+		d.mu.Unlock()
+		JSON(w, objects{Method: "Put Object", Objects: []objectStat{stat(args[1], ob)}})
+	case "lfs/head_object", "lfs/delete_object", "lfs/get_object":
+		d.mu.Lock()
+		ob, ok := d.buckets[args[0]][args[1]]
+		if ok && cmd == "lfs/delete_object" {
+			delete(d.buckets[args[0]], args[1])
+		}
+		d.mu.Unlock()
+		if !ok {
+			Error(w, "object not exist")
+			return
+		}
+		if cmd == "lfs/get_object" {
+			data := ob.data
+			q := r.URL.Query()
+			if off, err := strconv.ParseInt(q.Get("offset"), 10, 64); err == nil && off <= int64(len(data)) {
+				data = data[off:]
+			}
+			if n, err := strconv.ParseInt(q.Get("length"), 10, 64); err == nil && n < int64(len(data)) {
+				data = data[:n]
+			}
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(data)
+			return
+		}
+		JSON(w, objects{Method: "Object", Objects: []objectStat{stat(args[1], ob)}})
+	case "lfs/list_objects":
+		prefix := r.URL.Query().Get("prefix")
+		d.mu.Lock()
+		bucket, ok := d.buckets[args[0]]
+		var obs []objectStat
+		for name, ob := range bucket {
+			if strings.HasPrefix(name, prefix) {
+				obs = append(obs, stat(name, ob))
+			}
+		}
+		d.mu.Unlock()
+		if !ok {
+			Error(w, "bucket not exist")
+			return
+		}
+		sort.Slice(obs, func(i, j int) bool { return obs[i].ObjectName < obs[j].ObjectName })
+		JSON(w, objects{Method: "List Objects", Objects: obs})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func stat(name string, ob *object) objectStat {
+	sum := md5.Sum(ob.data)
+	return objectStat{
+		ObjectName:  name,
+		ObjectSize:  int64(len(ob.data)),
+		MD5:         hex.EncodeToString(sum[:]),
+		Ctime:       ob.ctime.Format(timeLayout),
+		ContentType: ob.contentType,
+		Metadata:    ob.metadata,
+	}
+}
+
+// JSON answers with v.
+func JSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// Error answers with a daemon error carrying msg.
+func Error(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(struct {
+		Command string
+		Message string
+		Code    int
+	}{Message: msg})
+}
@@ -0,0 +1,282 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// BucketMetaObject is the object a bucket's metadata is kept in when the
+// daemon cannot store it natively. ListObjects hides it.
+const BucketMetaObject = ".mefs-bucket-meta"
+
+// bucketMetaTemp is where new metadata is uploaded before it replaces
+// BucketMetaObject.
+const bucketMetaTemp = BucketMetaObject + ".tmp"
+
+var ErrQuotaExceeded = errors.New("bucket quota exceeded")
+
+// LifecycleRule expires the objects whose name starts with Prefix once they
+// are older than ExpireDays. An empty Prefix matches the whole bucket.
+type LifecycleRule struct {
+	ID         string
+	Prefix     string
+	ExpireDays int
+}
+
+// BucketQuota limits what a bucket may hold. Zero means unlimited.
+type BucketQuota struct {
+	MaxSize    int64
+	MaxObjects int64
+}
+
+// BucketMeta is the user controlled metadata of a bucket.
+type BucketMeta struct {
+	Tags      map[string]string
+	Lifecycle []LifecycleRule
+	Quota     BucketQuota
+}
+
+func (r LifecycleRule) validate() error {
+	if r.ExpireDays < 1 {
+		return fmt.Errorf("lifecycle rule %q: expire days must be at least 1", r.ID)
+	}
+	return nil
+}
+
+func (q BucketQuota) validate() error {
+	if q.MaxSize < 0 || q.MaxObjects < 0 {
+		return errors.New("bucket quota must not be negative")
+	}
+	return nil
+}
+
+// GetBucketMeta returns the tags, lifecycle rules and quota of a bucket.
+func (s *Shell) GetBucketMeta(BucketName string, options ...LfsOpts) (*BucketMeta, error) {
+	var meta BucketMeta
+	rb := s.Request("lfs/get_bucket_meta", BucketName)
+	for _, option := range options {
+		if err := option(rb); err != nil {
+			return nil, err
+		}
+	}
+	err := rb.Exec(context.Background(), &meta)
+	if isCommandNotFound(err) {
+		return s.getBucketMetaObject(BucketName, options...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// SetBucketMeta replaces the tags, lifecycle rules and quota of a bucket.
+func (s *Shell) SetBucketMeta(BucketName string, meta *BucketMeta, options ...LfsOpts) error {
+	for _, rule := range meta.Lifecycle {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+	}
+	if err := meta.Quota.validate(); err != nil {
+		return err
+	}
+	buf, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	rb := s.Request("lfs/set_bucket_meta", BucketName)
+	for _, option := range options {
+		if err := option(rb); err != nil {
+			return err
+		}
+	}
+	rb.Option("meta", buf)
+	err = rb.Exec(context.Background(), nil)
+	if isCommandNotFound(err) {
+		return s.putBucketMetaObject(BucketName, buf, options...)
+	}
+	return err
+}
+
+func (s *Shell) GetBucketTags(BucketName string, options ...LfsOpts) (map[string]string, error) {
+	meta, err := s.GetBucketMeta(BucketName, options...)
+	if err != nil {
+		return nil, err
+	}
+	return meta.Tags, nil
+}
+
+func (s *Shell) SetBucketTags(BucketName string, tags map[string]string, options ...LfsOpts) error {
+	return s.updateBucketMeta(BucketName, func(meta *BucketMeta) {
+		meta.Tags = tags
+	}, options...)
+}
+
+func (s *Shell) GetBucketLifecycle(BucketName string, options ...LfsOpts) ([]LifecycleRule, error) {
+	meta, err := s.GetBucketMeta(BucketName, options...)
+	if err != nil {
+		return nil, err
+	}
+	return meta.Lifecycle, nil
+}
+
+func (s *Shell) SetBucketLifecycle(BucketName string, rules []LifecycleRule, options ...LfsOpts) error {
+	return s.updateBucketMeta(BucketName, func(meta *BucketMeta) {
+		meta.Lifecycle = rules
+	}, options...)
+}
+
+func (s *Shell) GetBucketQuota(BucketName string, options ...LfsOpts) (*BucketQuota, error) {
+	meta, err := s.GetBucketMeta(BucketName, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &meta.Quota, nil
+}
+
+func (s *Shell) SetBucketQuota(BucketName string, quota BucketQuota, options ...LfsOpts) error {
+	return s.updateBucketMeta(BucketName, func(meta *BucketMeta) {
+		meta.Quota = quota
+	}, options...)
+}
+
+// CheckBucketQuota returns ErrQuotaExceeded if adding an object of the given
+// size would take the bucket over its quota. PutObject checks it by itself.
+func (s *Shell) CheckBucketQuota(BucketName string, size int64, options ...LfsOpts) error {
+	quota, err := s.GetBucketQuota(BucketName, options...)
+	if err != nil {
+		return err
+	}
+	return s.checkQuota(quota, BucketName, size, 1, options...)
+}
+
+// uploadQuota returns the quota PutObject enforces on a bucket, or nil if
+// there is none. A bucket without metadata has none, and an upload does
+// not fail because the metadata could not be read.
+func (s *Shell) uploadQuota(BucketName string, options ...LfsOpts) *BucketQuota {
+	quota, err := s.GetBucketQuota(BucketName, options...)
+	if err != nil || (quota.MaxSize == 0 && quota.MaxObjects == 0) {
+		return nil
+	}
+	return quota
+}
+
+// checkQuota checks that count more objects, of size bytes in all, fit in
+// the quota of a bucket.
+func (s *Shell) checkQuota(quota *BucketQuota, BucketName string, size, count int64, options ...LfsOpts) error {
+	if quota.MaxSize == 0 && quota.MaxObjects == 0 {
+		return nil
+	}
+	used, n, err := s.bucketUsage(BucketName, options...)
+	if err != nil {
+		return err
+	}
+	if quota.MaxSize > 0 && used+size > quota.MaxSize {
+		return ErrQuotaExceeded
+	}
+	if quota.MaxObjects > 0 && n+count > quota.MaxObjects {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// bucketUsage sums up the size and the number of the objects of a bucket.
+// It asks the daemon, as the metadata cache may be behind.
+func (s *Shell) bucketUsage(BucketName string, options ...LfsOpts) (size, count int64, err error) {
+	rb := s.Request("lfs/list_objects", BucketName)
+	for _, option := range options {
+		if err := option(rb); err != nil {
+			return 0, 0, err
+		}
+	}
+	var objs Objects
+	if err := rb.Exec(context.Background(), &objs); err != nil {
+		return 0, 0, err
+	}
+	for _, ob := range objs.Objects {
+		if isBucketMetaObject(ob.ObjectName) {
+			continue
+		}
+		size += ob.ObjectSize
+		count++
+	}
+	return size, count, nil
+}
+
+func (s *Shell) updateBucketMeta(BucketName string, update func(*BucketMeta), options ...LfsOpts) error {
+	meta, err := s.GetBucketMeta(BucketName, options...)
+	if err != nil {
+		return err
+	}
+	update(meta)
+	return s.SetBucketMeta(BucketName, meta, options...)
+}
+
+func (s *Shell) getBucketMetaObject(BucketName string, options ...LfsOpts) (*BucketMeta, error) {
+	var meta BucketMeta
+	objs, err := s.listObjects(BucketName, append(options[:len(options):len(options)], SetPrefixFilter(BucketMetaObject))...)
+	if err != nil {
+		return nil, err
+	}
+	name := ""
+	for _, ob := range objs.Objects {
+		switch {
+		case ob.ObjectName == BucketMetaObject:
+			name = ob.ObjectName
+		case ob.ObjectName == bucketMetaTemp && name == "":
+			// an update that did not get to move it into place
+			name = ob.ObjectName
+		}
+	}
+	if name == "" {
+		return &meta, nil
+	}
+
+	r, err := s.GetObject(name, BucketName, options...)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if err := json.NewDecoder(r).Decode(&meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// putBucketMetaObject uploads the metadata under a temporary name first and
+// only then replaces the old object, so a failed upload leaves it intact.
+func (s *Shell) putBucketMetaObject(BucketName string, buf []byte, options ...LfsOpts) error {
+	old, err := s.listObjects(BucketName, append(options[:len(options):len(options)], SetPrefixFilter(BucketMetaObject))...)
+	if err != nil {
+		return err
+	}
+	exists := false
+	for _, ob := range old.Objects {
+		switch ob.ObjectName {
+		case BucketMetaObject:
+			exists = true
+		case bucketMetaTemp:
+			if _, err := s.DeleteObject(bucketMetaTemp, BucketName, options...); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := s.PutObject(bytes.NewReader(buf), bucketMetaTemp, BucketName, options...); err != nil {
+		return err
+	}
+	// the daemon does not replace objects in place
+	if exists {
+		if _, err := s.DeleteObject(BucketMetaObject, BucketName, options...); err != nil {
+			return err
+		}
+	}
+	_, err = s.MoveObject(BucketName, bucketMetaTemp, BucketName, BucketMetaObject, options...)
+	return err
+}
+
+func isBucketMetaObject(name string) bool {
+	return name == BucketMetaObject || name == bucketMetaTemp
+}
@@ -9,7 +9,7 @@ import (
 type BucketStat struct {
 	BucketName  string
 	BucketID    int32
-	Ctime       string
+	Ctime       Time
 	Policy      int32
 	DataCount   int32
 	ParityCount int32
@@ -45,7 +45,9 @@ func (s *Shell) HeadBucket(BucketName string, options ...LfsOpts) (*Buckets, err
 	var bks Buckets
 	rb := s.Request("lfs/head_Bucket", BucketName)
 	for _, option := range options {
-		option(rb)
+		if err := option(rb); err != nil {
+			return nil, err
+		}
 	}
 
 	if err := rb.Exec(context.Background(), &bks); err != nil {
@@ -58,7 +60,9 @@ func (s *Shell) ListBuckets(options ...LfsOpts) (*Buckets, error) {
 	var bks Buckets
 	rb := s.Request("lfs/list_buckets")
 	for _, option := range options {
-		option(rb)
+		if err := option(rb); err != nil {
+			return nil, err
+		}
 	}
 	if err := rb.Exec(context.Background(), &bks); err != nil {
 		return nil, err
@@ -70,19 +74,32 @@ func (s *Shell) CreateBucket(BucketName string, options ...LfsOpts) (*Buckets, e
 	var bk Buckets
 	rb := s.Request("lfs/create_bucket", BucketName)
 	for _, option := range options {
-		option(rb)
+		if err := option(rb); err != nil {
+			return nil, err
+		}
 	}
+	defer s.invalidateMeta(rb, BucketName, "")
 	if err := rb.Exec(context.Background(), &bk); err != nil {
 		return nil, err
 	}
 	return &bk, nil
 }
 
+// DeleteBucket deletes a bucket, which must be empty unless Recursive(true)
+// is given.
 func (s *Shell) DeleteBucket(BucketName string, options ...LfsOpts) (*Buckets, error) {
 	var bk Buckets
 	rb := s.Request("lfs/delete_bucket", BucketName)
 	for _, option := range options {
-		option(rb)
+		if err := option(rb); err != nil {
+			return nil, err
+		}
+	}
+	defer s.invalidateMeta(rb, BucketName, "")
+	if rb.lfs.recursive {
+		if err := s.emptyBucket(BucketName, options...); err != nil {
+			return nil, err
+		}
 	}
 	if err := rb.Exec(context.Background(), &bk); err != nil {
 		return nil, err
@@ -0,0 +1,274 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrChallengeStatusUnsupported is returned by daemons that do not serve
+// lfs/challenge_status, which the challenge calls need. The daemon has no
+// other command the status can be rebuilt from.
+var ErrChallengeStatusUnsupported = errors.New("daemon does not report challenge status")
+
+// StripeHealth says how close a stripe is to being unrecoverable.
+type StripeHealth int
+
+const (
+	// StripeHealthy means every shard passed its latest challenge.
+	StripeHealthy StripeHealth = iota
+	// StripeDegraded means some shards failed but more may fail safely.
+	StripeDegraded
+	// StripeAtRisk means one more failed shard makes the stripe
+	// unrecoverable.
+	StripeAtRisk
+	// StripeLost means more shards failed than parity can rebuild.
+	StripeLost
+)
+
+func (h StripeHealth) String() string {
+	switch h {
+	case StripeHealthy:
+		return "healthy"
+	case StripeDegraded:
+		return "degraded"
+	case StripeAtRisk:
+		return "at risk"
+	case StripeLost:
+		return "lost"
+	default:
+		return fmt.Sprintf("StripeHealth(%d)", int(h))
+	}
+}
+
+// ShardChallenge is the latest challenge of one shard of a stripe.
+type ShardChallenge struct {
+	Index          int
+	Provider       string
+	LatestChalTime Time
+	Passed         bool
+}
+
+// ChallengeResult is one entry of an object's challenge history.
+type ChallengeResult struct {
+	Time       Time
+	Provider   string
+	StripeID   int
+	ShardIndex int
+	Passed     bool
+}
+
+// StripeChallenge is the challenge state of one stripe of an object.
+type StripeChallenge struct {
+	StripeID int
+	Shards   []ShardChallenge
+	Health   StripeHealth
+}
+
+// Failed returns how many shards of the stripe failed their latest
+// challenge.
+func (sc StripeChallenge) Failed() int {
+	failed := 0
+	for _, sh := range sc.Shards {
+		if !sh.Passed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// ObjectChallenge is what the keepers know about challenging the providers
+// that store an object.
+type ObjectChallenge struct {
+	BucketName     string
+	ObjectName     string
+	LatestChalTime Time
+	Stripes        []StripeChallenge
+	History        []ChallengeResult
+}
+
+// Providers returns the providers responsible for the object's shards.
+func (oc ObjectChallenge) Providers() []string {
+	seen := make(map[string]bool)
+	var pros []string
+	for _, st := range oc.Stripes {
+		for _, sh := range st.Shards {
+			if sh.Provider != "" && !seen[sh.Provider] {
+				seen[sh.Provider] = true
+				pros = append(pros, sh.Provider)
+			}
+		}
+	}
+	sort.Strings(pros)
+	return pros
+}
+
+// AtRisk returns the stripes that are at risk or already lost.
+func (oc ObjectChallenge) AtRisk() []StripeChallenge {
+	var risky []StripeChallenge
+	for _, st := range oc.Stripes {
+		if st.Health >= StripeAtRisk {
+			risky = append(risky, st)
+		}
+	}
+	return risky
+}
+
+// Health returns the health of the object's worst stripe.
+func (oc ObjectChallenge) Health() StripeHealth {
+	worst := StripeHealthy
+	for _, st := range oc.Stripes {
+		if st.Health > worst {
+			worst = st.Health
+		}
+	}
+	return worst
+}
+
+func (oc ObjectChallenge) String() string {
+	var str bytes.Buffer
+	fmt.Fprintf(&str, "ObjectName: %s\n--BucketName: %s\n--LatestChalTime: %s\n--Health: %s\n",
+		oc.ObjectName, oc.BucketName, oc.LatestChalTime, oc.Health())
+	for _, st := range oc.Stripes {
+		fmt.Fprintf(&str, "--Stripe %d: %s, %d of %d shards failed\n", st.StripeID, st.Health, st.Failed(), len(st.Shards))
+	}
+	return str.String()
+}
+
+// BucketHealth summarizes the challenge state of every object of a bucket.
+type BucketHealth struct {
+	BucketName string
+	Objects    int
+	Healthy    int
+	Degraded   int
+	AtRisk     []string
+	Lost       []string
+	// Errors holds the objects whose challenge state could not be read,
+	// with why.
+	Errors     map[string]error
+	Challenges int
+	Failures   int
+}
+
+func (bh BucketHealth) String() string {
+	return fmt.Sprintf(
+		"BucketName: %s\n--Objects: %d\n--Healthy: %d\n--Degraded: %d\n--AtRisk: %d\n--Lost: %d\n--Unknown: %d\n--Challenges: %d\n--Failures: %d\n",
+		bh.BucketName,
+		bh.Objects,
+		bh.Healthy,
+		bh.Degraded,
+		len(bh.AtRisk),
+		len(bh.Lost),
+		len(bh.Errors),
+		bh.Challenges,
+		bh.Failures,
+	)
+}
+
+// stripeHealth grades a stripe given how many parity shards its bucket
+// uses.
+func stripeHealth(failed, parity int) StripeHealth {
+	switch {
+	case failed == 0:
+		return StripeHealthy
+	case failed < parity:
+		return StripeDegraded
+	case failed == parity:
+		return StripeAtRisk
+	default:
+		return StripeLost
+	}
+}
+
+// ChallengeStatus returns the latest challenges of an object's shards, their
+// history, and how healthy each stripe is given the bucket's policy. It
+// fails with ErrChallengeStatusUnsupported if the daemon does not serve
+// lfs/challenge_status.
+func (s *Shell) ChallengeStatus(BucketName, ObjectName string, options ...LfsOpts) (*ObjectChallenge, error) {
+	bks, err := s.HeadBucket(BucketName, options...)
+	if err != nil {
+		return nil, err
+	}
+	if len(bks.Buckets) == 0 {
+		return nil, fmt.Errorf("no such bucket: %s", BucketName)
+	}
+	return s.challengeStatus(BucketName, ObjectName, bks.Buckets[0], options...)
+}
+
+// BucketChallengeHealth checks the challenge state of every object of a
+// bucket. An object whose state cannot be read is put in Errors and the
+// others are still checked.
+func (s *Shell) BucketChallengeHealth(BucketName string, options ...LfsOpts) (*BucketHealth, error) {
+	bks, err := s.HeadBucket(BucketName, options...)
+	if err != nil {
+		return nil, err
+	}
+	if len(bks.Buckets) == 0 {
+		return nil, fmt.Errorf("no such bucket: %s", BucketName)
+	}
+	objs, err := s.ListObjects(BucketName, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	health := &BucketHealth{BucketName: BucketName, Errors: make(map[string]error)}
+	for _, ob := range objs.Objects {
+		if ob.Dir {
+			continue
+		}
+		health.Objects++
+		oc, err := s.challengeStatus(BucketName, ob.ObjectName, bks.Buckets[0], options...)
+		if err == ErrChallengeStatusUnsupported {
+			return nil, err
+		}
+		if err != nil {
+			health.Errors[ob.ObjectName] = err
+			continue
+		}
+		health.Challenges += len(oc.History)
+		for _, res := range oc.History {
+			if !res.Passed {
+				health.Failures++
+			}
+		}
+		switch oc.Health() {
+		case StripeHealthy:
+			health.Healthy++
+		case StripeDegraded:
+			health.Degraded++
+		case StripeAtRisk:
+			health.AtRisk = append(health.AtRisk, ob.ObjectName)
+		case StripeLost:
+			health.Lost = append(health.Lost, ob.ObjectName)
+		}
+	}
+	return health, nil
+}
+
+func (s *Shell) challengeStatus(BucketName, ObjectName string, bk BucketStat, options ...LfsOpts) (*ObjectChallenge, error) {
+	var oc ObjectChallenge
+	rb := s.Request("lfs/challenge_status", BucketName, ObjectName)
+	for _, option := range options {
+		if err := option(rb); err != nil {
+			return nil, err
+		}
+	}
+	err := rb.Exec(context.Background(), &oc)
+	if isCommandNotFound(err) {
+		return nil, ErrChallengeStatusUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	parity := int(bk.ParityCount)
+	if p, err := bk.DecodePolicy(); err == nil {
+		_, parity = p.Counts()
+	}
+	for i := range oc.Stripes {
+		oc.Stripes[i].Health = stripeHealth(oc.Stripes[i].Failed(), parity)
+	}
+	return &oc, nil
+}
@@ -0,0 +1,75 @@
+package shell
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+	"github.com/xcshuan/go-mefs-api/internal/fakedaemon"
+)
+
+func TestChallengeStatus(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	_, err := s.CreateBucket("b0", SetBucketPolicy(ErasureCode{Data: 2, Parity: 1}))
+	is.NoErr(err)
+	d.Put("b0", "good", []byte("x"), time.Now())
+	d.Put("b0", "bad", []byte("x"), time.Now())
+	d.Put("b0", "broken", []byte("x"), time.Now())
+
+	shards := func(passed ...bool) []ShardChallenge {
+		var shs []ShardChallenge
+		for i, p := range passed {
+			shs = append(shs, ShardChallenge{Index: i, Provider: string(rune('a' + i)), Passed: p})
+		}
+		return shs
+	}
+	d.Handle("lfs/challenge_status", func(w http.ResponseWriter, r *http.Request) {
+		args := r.URL.Query()["arg"]
+		oc := ObjectChallenge{BucketName: args[0], ObjectName: args[1]}
+		if args[1] == "broken" {
+			fakedaemon.Error(w, "no keeper answered")
+			return
+		}
+		if args[1] == "good" {
+			oc.Stripes = []StripeChallenge{{StripeID: 0, Shards: shards(true, true, true)}}
+			oc.History = []ChallengeResult{{Provider: "a", Passed: true}}
+		} else {
+			oc.Stripes = []StripeChallenge{
+				{StripeID: 0, Shards: shards(true, false, true)},
+				{StripeID: 1, Shards: shards(false, false, true)},
+			}
+			oc.History = []ChallengeResult{{Provider: "b", Passed: false}, {Provider: "a", Passed: false}}
+		}
+		fakedaemon.JSON(w, oc)
+	})
+
+	oc, err := s.ChallengeStatus("b0", "bad")
+	is.NoErr(err)
+	is.Equal(oc.Providers(), []string{"a", "b", "c"})
+	is.Equal(oc.Stripes[0].Health, StripeAtRisk)
+	is.Equal(oc.Stripes[1].Health, StripeLost)
+	is.Equal(len(oc.AtRisk()), 2)
+	is.Equal(oc.Health(), StripeLost)
+
+	// one object that can not be checked does not spoil the summary
+	health, err := s.BucketChallengeHealth("b0")
+	is.NoErr(err)
+	is.Equal(health.Objects, 3)
+	is.Equal(health.Healthy, 1)
+	is.Equal(health.Lost, []string{"bad"})
+	is.Equal(len(health.Errors), 1)
+	is.Err(health.Errors["broken"])
+	is.Equal(health.Challenges, 3)
+	is.Equal(health.Failures, 2)
+
+	d.Handle("lfs/challenge_status", nil)
+	_, err = s.ChallengeStatus("b0", "good")
+	is.Equal(err, ErrChallengeStatusUnsupported)
+	_, err = s.BucketChallengeHealth("b0")
+	is.Equal(err, ErrChallengeStatusUnsupported)
+}
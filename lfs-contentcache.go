@@ -0,0 +1,309 @@
+package shell
+
+import (
+	"container/list"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentCacheStats counts how the content cache has been doing.
+type ContentCacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	// Files and Bytes are what the cache holds right now.
+	Files int
+	Bytes int64
+}
+
+// EnableContentCache makes GetObject, and so GetObjectToFile, keep the
+// objects it downloads in dir, up to maxBytes in all, evicting the least
+// recently used ones first. An object is served from dir only if its MD5
+// still matches the one HeadObject reports, so objects replaced since they
+// were cached are downloaded again. Objects the daemon reports no MD5 for
+// are never cached. What dir already holds from an earlier cache is kept.
+// A maxBytes of zero disables the cache.
+func (s *Shell) EnableContentCache(dir string, maxBytes int64) error {
+	var cc *contentCache
+	if maxBytes > 0 {
+		var err error
+		if cc, err = openContentCache(dir, maxBytes); err != nil {
+			return err
+		}
+	}
+	s.contentMu.Lock()
+	defer s.contentMu.Unlock()
+	s.contentCache = cc
+	return nil
+}
+
+// ContentCacheStats returns the statistics of the content cache, which are
+// zero if it is not enabled.
+func (s *Shell) ContentCacheStats() ContentCacheStats {
+	cc := s.getContentCache()
+	if cc == nil {
+		return ContentCacheStats{}
+	}
+	return cc.stats()
+}
+
+func (s *Shell) getContentCache() *contentCache {
+	s.contentMu.RLock()
+	defer s.contentMu.RUnlock()
+	return s.contentCache
+}
+
+// contentKey names the cache file of a version of an object.
+func contentKey(address, bucket, object, md5Sum string) string {
+	h := sha256.New()
+	for _, part := range []string{address, bucket, object, strings.ToLower(md5Sum)} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// contentCache is a size bounded LRU cache of object data on disk. Files
+// are written under a temporary name and renamed once complete, so the
+// files with a key for name are always whole.
+type contentCache struct {
+	dir string
+	max int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+	st      ContentCacheStats
+}
+
+type contentEntry struct {
+	name string
+	size int64
+}
+
+const contentTempPattern = "fill-*.tmp"
+
+func openContentCache(dir string, maxBytes int64) (*contentCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	cc := &contentCache{
+		dir:     dir,
+		max:     maxBytes,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+
+	// oldest first, so the most recently used end up in front
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+	for _, fi := range infos {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		if ok, _ := filepath.Match(contentTempPattern, fi.Name()); ok {
+			// left over by a download that never finished
+			os.Remove(filepath.Join(dir, fi.Name()))
+			continue
+		}
+		if _, err := hex.DecodeString(fi.Name()); err != nil || len(fi.Name()) != 2*sha256.Size {
+			continue
+		}
+		cc.entries[fi.Name()] = cc.lru.PushFront(&contentEntry{name: fi.Name(), size: fi.Size()})
+		cc.size += fi.Size()
+	}
+	cc.mu.Lock()
+	cc.evictLocked()
+	cc.mu.Unlock()
+	return cc, nil
+}
+
+// open returns the cached data of name, counting a hit or a miss.
+func (cc *contentCache) open(name string) (*os.File, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	el, ok := cc.entries[name]
+	if !ok {
+		cc.st.Misses++
+		return nil, false
+	}
+	p := filepath.Join(cc.dir, name)
+	f, err := os.Open(p)
+	if err != nil {
+		cc.removeLocked(el)
+		cc.st.Misses++
+		return nil, false
+	}
+	cc.st.Hits++
+	cc.lru.MoveToFront(el)
+	// keep the order across restarts
+	now := time.Now()
+	os.Chtimes(p, now, now)
+	return f, true
+}
+
+// fill returns a reader of rc that stores what is read in the cache under
+// name once all of it has been read and found to hash to md5Sum.
+func (cc *contentCache) fill(name, md5Sum string, rc io.ReadCloser) io.ReadCloser {
+	f, err := ioutil.TempFile(cc.dir, contentTempPattern)
+	if err != nil {
+		return rc
+	}
+	return &cacheFillReader{rc: rc, cc: cc, name: name, md5: md5Sum, f: f, hash: md5.New()}
+}
+
+func (cc *contentCache) add(name, tmp string, size int64) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if err := os.Rename(tmp, filepath.Join(cc.dir, name)); err != nil {
+		os.Remove(tmp)
+		return
+	}
+	if el, ok := cc.entries[name]; ok {
+		cc.size -= el.Value.(*contentEntry).size
+		el.Value = &contentEntry{name: name, size: size}
+		cc.lru.MoveToFront(el)
+	} else {
+		cc.entries[name] = cc.lru.PushFront(&contentEntry{name: name, size: size})
+	}
+	cc.size += size
+	cc.evictLocked()
+}
+
+// drop removes a cached file found to be corrupt.
+func (cc *contentCache) drop(name string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if el, ok := cc.entries[name]; ok {
+		cc.removeLocked(el)
+	}
+}
+
+func (cc *contentCache) evictLocked() {
+	for cc.size > cc.max && cc.lru.Len() > 0 {
+		cc.removeLocked(cc.lru.Back())
+		cc.st.Evictions++
+	}
+}
+
+func (cc *contentCache) removeLocked(el *list.Element) {
+	e := el.Value.(*contentEntry)
+	cc.lru.Remove(el)
+	delete(cc.entries, e.name)
+	cc.size -= e.size
+	// readers that have it open keep reading it
+	os.Remove(filepath.Join(cc.dir, e.name))
+}
+
+func (cc *contentCache) stats() ContentCacheStats {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	st := cc.st
+	st.Files = cc.lru.Len()
+	st.Bytes = cc.size
+	return st
+}
+
+// cacheFillReader copies what is read from rc to a temporary file of the
+// cache and adds it to the cache at EOF. Errors of the cache only stop the
+// copy; the reader goes on serving rc.
+type cacheFillReader struct {
+	rc   io.ReadCloser
+	cc   *contentCache
+	name string
+	md5  string
+	f    *os.File
+	hash hash.Hash
+	n    int64
+}
+
+func (cr *cacheFillReader) Read(p []byte) (int, error) {
+	n, err := cr.rc.Read(p)
+	if cr.f == nil {
+		return n, err
+	}
+	if n > 0 {
+		cr.hash.Write(p[:n])
+		cr.n += int64(n)
+		if _, werr := cr.f.Write(p[:n]); werr != nil || cr.n > cr.cc.max {
+			cr.abort()
+			return n, err
+		}
+	}
+	switch {
+	case err == io.EOF:
+		cr.commit()
+	case err != nil:
+		cr.abort()
+	}
+	return n, err
+}
+
+func (cr *cacheFillReader) commit() {
+	f := cr.f
+	cr.f = nil
+	if err := f.Close(); err != nil || !strings.EqualFold(hex.EncodeToString(cr.hash.Sum(nil)), cr.md5) {
+		os.Remove(f.Name())
+		return
+	}
+	cr.cc.add(cr.name, f.Name(), cr.n)
+}
+
+func (cr *cacheFillReader) abort() {
+	cr.f.Close()
+	os.Remove(cr.f.Name())
+	cr.f = nil
+}
+
+func (cr *cacheFillReader) Close() error {
+	if cr.f != nil {
+		cr.abort()
+	}
+	return cr.rc.Close()
+}
+
+// cachedRange returns a part of a cached file, as SetRange asks.
+func cachedRange(f *os.File, offset, length int64) (io.ReadCloser, error) {
+	if length == 0 {
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		length = fi.Size() - offset
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, offset, length), f}, nil
+}
+
+// cachedReader reads a cached file through a verifyingReader, dropping
+// the file from the cache if it turns out to be corrupt.
+type cachedReader struct {
+	*verifyingReader
+	cc   *contentCache
+	name string
+}
+
+func (cr *cachedReader) Read(p []byte) (int, error) {
+	n, err := cr.verifyingReader.Read(p)
+	if err == ErrMD5Mismatch || err == ErrSHA256Mismatch {
+		cr.cc.drop(cr.name)
+	}
+	return n, err
+}
@@ -0,0 +1,160 @@
+package shell
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+)
+
+func readObject(s *Shell, bucket, name string) ([]byte, error) {
+	r, err := s.GetObject(name, bucket)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func TestContentCache(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+	dir, err := ioutil.TempDir("", "mefs-cache")
+	is.NoErr(err)
+	defer os.RemoveAll(dir)
+	is.NoErr(s.EnableContentCache(dir, 10))
+
+	d.Put("b0", "a", []byte("aaaa"), time.Now())
+	for i := 0; i < 2; i++ {
+		data, err := readObject(s, "b0", "a")
+		is.NoErr(err)
+		is.Equal(string(data), "aaaa")
+	}
+	is.Equal(countCalls(d, "lfs/get_object"), 1)
+	st := s.ContentCacheStats()
+	is.Equal(st.Hits, int64(1))
+	is.Equal(st.Misses, int64(1))
+	is.Equal(st.Files, 1)
+	is.Equal(st.Bytes, int64(4))
+
+	// ranges of cached objects are read from the cache
+	r, err := s.GetObject("a", "b0", SetRange(1, 2))
+	is.NoErr(err)
+	data, err := ioutil.ReadAll(r)
+	is.NoErr(err)
+	is.Equal(string(data), "aa")
+	r.Close()
+	is.Equal(countCalls(d, "lfs/get_object"), 1)
+
+	// a new version has another MD5 and is downloaded again
+	d.Put("b0", "a", []byte("AAAA"), time.Now())
+	data, err = readObject(s, "b0", "a")
+	is.NoErr(err)
+	is.Equal(string(data), "AAAA")
+	is.Equal(countCalls(d, "lfs/get_object"), 2)
+
+	// objects bigger than the cache are not kept
+	d.Put("b0", "big", []byte("0123456789abc"), time.Now())
+	_, err = readObject(s, "b0", "big")
+	is.NoErr(err)
+	_, err = readObject(s, "b0", "big")
+	is.NoErr(err)
+	is.Equal(countCalls(d, "lfs/get_object"), 4)
+
+	// partial reads are not kept either
+	d.Put("b0", "b", []byte("bbbb"), time.Now())
+	r, err = s.GetObject("b", "b0")
+	is.NoErr(err)
+	_, err = r.Read(make([]byte, 2))
+	is.NoErr(err)
+	is.NoErr(r.Close())
+	is.Equal(s.ContentCacheStats().Files, 2)
+
+	// GetObjectToFile goes through the cache
+	out := filepath.Join(dir, "out")
+	is.NoErr(os.Mkdir(out, 0700))
+	is.NoErr(s.GetObjectToFile("b", "b0", out))
+	is.NoErr(s.GetObjectToFile("a", "b0", filepath.Join(out, "a2")))
+	got, err := ioutil.ReadFile(filepath.Join(out, "a2"))
+	is.NoErr(err)
+	is.Equal(string(got), "AAAA")
+	is.Equal(countCalls(d, "lfs/get_object"), 6)
+
+	// the first "aaaa" was evicted to make room
+	st = s.ContentCacheStats()
+	is.True(st.Bytes <= 10)
+	is.True(st.Evictions > 0)
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	is.NoErr(err)
+	is.Equal(len(files), st.Files+1)
+
+	is.NoErr(s.EnableContentCache(dir, 0))
+	is.Equal(s.ContentCacheStats(), ContentCacheStats{})
+}
+
+func TestContentCacheReopen(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	dir, err := ioutil.TempDir("", "mefs-cache")
+	is.NoErr(err)
+	defer os.RemoveAll(dir)
+
+	s := d.Shell()
+	is.NoErr(s.EnableContentCache(dir, 100))
+	d.Put("b0", "a", []byte("aaaa"), time.Now())
+	_, err = readObject(s, "b0", "a")
+	is.NoErr(err)
+	is.NoErr(ioutil.WriteFile(filepath.Join(dir, "fill-1.tmp"), []byte("x"), 0600))
+
+	s = d.Shell()
+	is.NoErr(s.EnableContentCache(dir, 100))
+	is.Equal(s.ContentCacheStats().Files, 1)
+	_, err = os.Stat(filepath.Join(dir, "fill-1.tmp"))
+	is.True(os.IsNotExist(err))
+	data, err := readObject(s, "b0", "a")
+	is.NoErr(err)
+	is.Equal(string(data), "aaaa")
+	is.Equal(countCalls(d, "lfs/get_object"), 1)
+
+	// a corrupt file fails the read and is dropped
+	name := contentKey("", "b0", "a", "74b87337454200d4d33f80c4663dc5e5")
+	is.NoErr(ioutil.WriteFile(filepath.Join(dir, name), []byte("aaab"), 0600))
+	_, err = readObject(s, "b0", "a")
+	is.Equal(err, ErrMD5Mismatch)
+	is.Equal(s.ContentCacheStats().Files, 0)
+	data, err = readObject(s, "b0", "a")
+	is.NoErr(err)
+	is.Equal(string(data), "aaaa")
+}
+
+func TestContentCacheMetaCache(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+	dir, err := ioutil.TempDir("", "mefs-cache")
+	is.NoErr(err)
+	defer os.RemoveAll(dir)
+	is.NoErr(s.EnableContentCache(dir, 100))
+	s.EnableMetaCache(10, time.Hour)
+
+	d.Put("b0", "a", []byte("aaaa"), time.Now())
+	_, err = readObject(s, "b0", "a")
+	is.NoErr(err)
+	_, err = s.HeadObject("a", "b0")
+	is.NoErr(err)
+
+	// another client replaces the object; the cached answer of HeadObject
+	// must not make the old content look current
+	d.Put("b0", "a", []byte("AAAA"), time.Now())
+	data, err := readObject(s, "b0", "a")
+	is.NoErr(err)
+	is.Equal(string(data), "AAAA")
+	is.Equal(countCalls(d, "lfs/get_object"), 2)
+}
@@ -0,0 +1,131 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// DefaultDeleteConcurrency is how many deletions DeleteObjects runs at once
+// unless SetConcurrency says otherwise.
+const DefaultDeleteConcurrency = 8
+
+// DeleteResult is the outcome of deleting one object.
+type DeleteResult struct {
+	ObjectName string
+	Err        error
+}
+
+// DeleteReport lists the outcome of a bulk delete, in the order the objects
+// were given.
+type DeleteReport struct {
+	BucketName string
+	Results    []DeleteResult
+}
+
+// Deleted returns the names of the objects that were deleted.
+func (dr DeleteReport) Deleted() []string {
+	var names []string
+	for _, res := range dr.Results {
+		if res.Err == nil {
+			names = append(names, res.ObjectName)
+		}
+	}
+	return names
+}
+
+// Failed returns the objects that could not be deleted with their errors.
+func (dr DeleteReport) Failed() map[string]error {
+	failed := make(map[string]error)
+	for _, res := range dr.Results {
+		if res.Err != nil {
+			failed[res.ObjectName] = res.Err
+		}
+	}
+	return failed
+}
+
+// Err summarizes the failures of the report, or returns nil if every object
+// was deleted.
+func (dr DeleteReport) Err() error {
+	failed := dr.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(failed))
+	for _, res := range dr.Results {
+		if res.Err != nil {
+			names = append(names, res.ObjectName)
+		}
+	}
+	return fmt.Errorf("failed to delete %d of %d objects in %s: %s (first error: %s)",
+		len(failed), len(dr.Results), dr.BucketName, strings.Join(names, ", "), failed[names[0]])
+}
+
+// DeleteObjects deletes the named objects of a bucket, running up to
+// SetConcurrency deletions at once. A failure does not stop the other
+// deletions; check the report for per-object errors.
+func (s *Shell) DeleteObjects(BucketName string, names []string, options ...LfsOpts) *DeleteReport {
+	report := &DeleteReport{
+		BucketName: BucketName,
+		Results:    make([]DeleteResult, len(names)),
+	}
+	// bad options fail every deletion, and so show up in the report
+	local, _ := localOptions(options)
+	workers := local.concurrency
+	if workers <= 0 {
+		workers = DefaultDeleteConcurrency
+	}
+	if workers > len(names) {
+		workers = len(names)
+	}
+
+	idx := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				_, err := s.DeleteObject(names[i], BucketName, options...)
+				report.Results[i] = DeleteResult{ObjectName: names[i], Err: err}
+			}
+		}()
+	}
+	for i := range names {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
+	return report
+}
+
+// DeletePrefix deletes every object of a bucket whose name starts with
+// prefix.
+func (s *Shell) DeletePrefix(BucketName, prefix string, options ...LfsOpts) (*DeleteReport, error) {
+	objs, err := s.ListObjects(BucketName, append(options[:len(options):len(options)], SetPrefixFilter(prefix))...)
+	if err != nil {
+		return nil, err
+	}
+	return s.DeleteObjects(BucketName, objectNames(objs, prefix), options...), nil
+}
+
+// emptyBucket deletes every object of a bucket, including the ones the
+// client keeps for itself.
+func (s *Shell) emptyBucket(BucketName string, options ...LfsOpts) error {
+	objs, err := s.listObjects(BucketName, options...)
+	if err != nil {
+		return err
+	}
+	return s.DeleteObjects(BucketName, objectNames(objs, ""), options...).Err()
+}
+
+func objectNames(objs *Objects, prefix string) []string {
+	names := make([]string, 0, len(objs.Objects))
+	for _, ob := range objs.Objects {
+		if strings.HasPrefix(ob.ObjectName, prefix) {
+			names = append(names, ob.ObjectName)
+		}
+	}
+	return names
+}
@@ -0,0 +1,58 @@
+package shell
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+)
+
+func TestDeleteObjects(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	_, err := s.CreateBucket("b0")
+	is.NoErr(err)
+	for _, name := range []string{"a", "b", "c"} {
+		d.Put("b0", name, []byte(name), time.Now())
+	}
+
+	report := s.DeleteObjects("b0", []string{"a", "missing", "c"}, SetConcurrency(2))
+	is.Equal(report.Deleted(), []string{"a", "c"})
+	is.Equal(len(report.Failed()), 1)
+	is.NotNil(report.Failed()["missing"])
+	is.Err(report.Err())
+
+	_, ok := d.Object("b0", "b")
+	is.True(ok)
+}
+
+func TestDeletePrefixAndBucketRecursive(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	_, err := s.CreateBucket("b0")
+	is.NoErr(err)
+	for _, name := range []string{"logs/1", "logs/2", "data/1"} {
+		d.Put("b0", name, []byte(name), time.Now())
+	}
+	is.NoErr(s.SetBucketTags("b0", map[string]string{"k": "v"}))
+
+	report, err := s.DeletePrefix("b0", "logs/")
+	is.NoErr(err)
+	is.NoErr(report.Err())
+	is.Equal(report.Deleted(), []string{"logs/1", "logs/2"})
+
+	_, err = s.DeleteBucket("b0")
+	is.Err(err)
+
+	_, err = s.DeleteBucket("b0", Recursive(true))
+	is.NoErr(err)
+	bks, err := s.ListBuckets()
+	is.NoErr(err)
+	is.Equal(len(bks.Buckets), 0)
+}
@@ -0,0 +1,91 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GroupInfo is the keeper group of a user: the keepers that manage the
+// user's data and the providers they placed it on.
+type GroupInfo struct {
+	Address   string
+	Ready     bool
+	Keepers   []NodeInfo
+	Providers []NodeInfo
+}
+
+// isGroupNotReady reports whether err says the user's group service has not
+// finished starting.
+func isGroupNotReady(err error) bool {
+	if err == ErrGroupServiceNotReady {
+		return true
+	}
+	e, ok := err.(*Error)
+	return ok && strings.Contains(e.Message, ErrGroupServiceNotReady.Error())
+}
+
+// ShowGroup returns the members of a user's keeper group and whether the
+// group service is ready.
+func (s *Shell) ShowGroup(address string, options ...LfsOpts) (*GroupInfo, error) {
+	return s.showGroup(context.Background(), address, options...)
+}
+
+func (s *Shell) showGroup(ctx context.Context, address string, options ...LfsOpts) (*GroupInfo, error) {
+	var group GroupInfo
+	rb := s.Request("lfs/show_group")
+	for _, option := range options {
+		if err := option(rb); err != nil {
+			return nil, err
+		}
+	}
+	rb.Option("address", address)
+	if err := rb.Exec(ctx, &group); err != nil {
+		return nil, err
+	}
+	if group.Address == "" {
+		group.Address = address
+	}
+	return &group, nil
+}
+
+// WaitGroupReady polls the group service of a user every interval until it
+// is ready. Uploads fail with ErrGroupServiceNotReady until then, e.g. right
+// after StartUser. It returns ErrGroupServiceNotReady if ctx ends first.
+func (s *Shell) WaitGroupReady(ctx context.Context, address string, interval time.Duration, options ...LfsOpts) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid group poll interval %s", interval)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		group, err := s.showGroup(ctx, address, options...)
+		switch {
+		case err == nil && group.Ready:
+			return nil
+		case ctx.Err() != nil:
+			return ErrGroupServiceNotReady
+		case err != nil && !isGroupNotReady(err):
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ErrGroupServiceNotReady
+		case <-ticker.C:
+		}
+	}
+}
+
+// RebuildGroup asks the daemon to rebuild a user's keeper group, e.g. after
+// keepers went offline.
+func (s *Shell) RebuildGroup(address string, options ...LfsOpts) error {
+	rb := s.Request("lfs/rebuild_group")
+	for _, option := range options {
+		if err := option(rb); err != nil {
+			return err
+		}
+	}
+	rb.Option("address", address)
+	return rb.Exec(context.Background(), nil)
+}
@@ -0,0 +1,68 @@
+package shell
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+	"github.com/xcshuan/go-mefs-api/internal/fakedaemon"
+)
+
+func TestWaitGroupReady(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	polls := 0
+	d.Handle("lfs/show_group", func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.URL.Query().Get("address"), "0xuser")
+		polls++
+		switch polls {
+		case 1:
+			fakedaemon.Error(w, "group service not ready")
+		case 2:
+			fakedaemon.JSON(w, GroupInfo{Keepers: []NodeInfo{{ID: "k1"}}})
+		default:
+			fakedaemon.JSON(w, GroupInfo{Ready: true, Keepers: []NodeInfo{{ID: "k1"}, {ID: "k2"}}})
+		}
+	})
+	is.NoErr(s.WaitGroupReady(context.Background(), "0xuser", time.Millisecond))
+	is.Err(s.WaitGroupReady(context.Background(), "0xuser", 0))
+	is.Equal(polls, 3)
+
+	group, err := s.ShowGroup("0xuser")
+	is.NoErr(err)
+	is.Equal(group.Address, "0xuser")
+	is.Equal(len(group.Keepers), 2)
+
+	d.Handle("lfs/show_group", func(w http.ResponseWriter, r *http.Request) {
+		fakedaemon.Error(w, "group service not ready")
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	is.Equal(s.WaitGroupReady(ctx, "0xuser", time.Millisecond), ErrGroupServiceNotReady)
+
+	// a request given up above may still be being served
+	d.Handle("lfs/show_group", func(w http.ResponseWriter, r *http.Request) {
+		fakedaemon.Error(w, "no such user")
+	})
+	is.Err(s.WaitGroupReady(context.Background(), "0xuser", time.Millisecond))
+
+	// a request that hangs is given up with ctx
+	release := make(chan struct{})
+	defer close(release)
+	d.Handle("lfs/show_group", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	})
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	is.Equal(s.WaitGroupReady(ctx, "0xuser", time.Hour), ErrGroupServiceNotReady)
+	is.True(time.Since(start) < 5*time.Second)
+}
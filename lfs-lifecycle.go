@@ -0,0 +1,129 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Expired reports whether an object created at ctime has outlived the rule
+// at now.
+func (r LifecycleRule) Expired(ctime, now time.Time) bool {
+	return !ctime.Add(time.Duration(r.ExpireDays) * 24 * time.Hour).After(now)
+}
+
+// SweepResult tells what a sweep of one bucket did.
+type SweepResult struct {
+	BucketName string
+	Deleted    []string
+	Errors     map[string]error
+}
+
+// LifecycleSweeper applies the lifecycle rules of a user's buckets from the
+// client, for daemons that do not expire objects themselves.
+type LifecycleSweeper struct {
+	shell    *Shell
+	interval time.Duration
+	options  []LfsOpts
+
+	// OnSweep, if set, is called after every bucket sweep.
+	OnSweep func(SweepResult)
+	// OnError, if set, is called when a sweep started by Run fails.
+	OnError func(error)
+}
+
+// NewLifecycleSweeper returns a sweeper that runs every interval. The options
+// are passed on to every request, e.g. SetAddress to pick the user.
+func (s *Shell) NewLifecycleSweeper(interval time.Duration, options ...LfsOpts) *LifecycleSweeper {
+	return &LifecycleSweeper{
+		shell:    s,
+		interval: interval,
+		options:  options,
+	}
+}
+
+// Run sweeps all buckets every interval until ctx is done.
+func (sw *LifecycleSweeper) Run(ctx context.Context) error {
+	if sw.interval <= 0 {
+		return fmt.Errorf("invalid lifecycle sweep interval %s", sw.interval)
+	}
+	ticker := time.NewTicker(sw.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := sw.SweepAll(ctx); err != nil && ctx.Err() == nil && sw.OnError != nil {
+			sw.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// SweepAll sweeps every bucket of the user once.
+func (sw *LifecycleSweeper) SweepAll(ctx context.Context) ([]SweepResult, error) {
+	bks, err := sw.shell.ListBuckets(sw.options...)
+	if err != nil {
+		return nil, err
+	}
+	var results []SweepResult
+	for _, bk := range bks.Buckets {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		res, err := sw.Sweep(ctx, bk.BucketName)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, *res)
+	}
+	return results, nil
+}
+
+// Sweep deletes the objects of one bucket that its lifecycle rules expire.
+func (sw *LifecycleSweeper) Sweep(ctx context.Context, BucketName string) (*SweepResult, error) {
+	res := &SweepResult{
+		BucketName: BucketName,
+		Errors:     make(map[string]error),
+	}
+	rules, err := sw.shell.GetBucketLifecycle(BucketName, sw.options...)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		opts := sw.options
+		if rule.Prefix != "" {
+			opts = append(opts[:len(opts):len(opts)], SetPrefixFilter(rule.Prefix))
+		}
+		objs, err := sw.shell.ListObjects(BucketName, opts...)
+		if err != nil {
+			return nil, err
+		}
+		for _, ob := range objs.Objects {
+			if ob.Dir || seen[ob.ObjectName] || !strings.HasPrefix(ob.ObjectName, rule.Prefix) {
+				continue
+			}
+			if ob.Ctime.IsZero() || !rule.Expired(ob.Ctime.Time, now) {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return res, err
+			}
+			seen[ob.ObjectName] = true
+			if _, err := sw.shell.DeleteObject(ob.ObjectName, BucketName, sw.options...); err != nil {
+				res.Errors[ob.ObjectName] = err
+				continue
+			}
+			res.Deleted = append(res.Deleted, ob.ObjectName)
+		}
+	}
+	if sw.OnSweep != nil {
+		sw.OnSweep(*res)
+	}
+	return res, nil
+}
@@ -0,0 +1,159 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+	"github.com/xcshuan/go-mefs-api/internal/fakedaemon"
+)
+
+func TestBucketMetaFallback(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	_, err := s.CreateBucket("b0")
+	is.NoErr(err)
+
+	is.NoErr(s.SetBucketTags("b0", map[string]string{"team": "archive"}))
+	is.NoErr(s.SetBucketQuota("b0", BucketQuota{MaxObjects: 1}))
+
+	tags, err := s.GetBucketTags("b0")
+	is.NoErr(err)
+	is.Equal(tags, map[string]string{"team": "archive"})
+
+	// the metadata object is hidden from listings and quotas
+	objs, err := s.ListObjects("b0")
+	is.NoErr(err)
+	is.Equal(len(objs.Objects), 0)
+	is.NoErr(s.CheckBucketQuota("b0", 10))
+
+	d.Put("b0", "a", []byte("a"), time.Now())
+	is.Equal(s.CheckBucketQuota("b0", 10), ErrQuotaExceeded)
+
+	is.Err(s.SetBucketLifecycle("b0", []LifecycleRule{{ID: "bad"}}))
+}
+
+func TestBucketMetaReplace(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	_, err := s.CreateBucket("b0")
+	is.NoErr(err)
+	is.NoErr(s.SetBucketTags("b0", map[string]string{"v": "1"}))
+	is.NoErr(s.SetBucketTags("b0", map[string]string{"v": "2"}))
+	_, ok := d.Object("b0", bucketMetaTemp)
+	is.False(ok)
+
+	// a failed upload keeps the old metadata
+	d.Handle("lfs/put_object", func(w http.ResponseWriter, r *http.Request) {
+		fakedaemon.Error(w, "no space left")
+	})
+	is.Err(s.SetBucketTags("b0", map[string]string{"v": "3"}))
+	tags, err := s.GetBucketTags("b0")
+	is.NoErr(err)
+	is.Equal(tags, map[string]string{"v": "2"})
+}
+
+func TestPutObjectQuota(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	_, err := s.CreateBucket("b0")
+	is.NoErr(err)
+	is.NoErr(s.SetBucketQuota("b0", BucketQuota{MaxSize: 8, MaxObjects: 2}))
+
+	_, err = s.PutObject(strings.NewReader("aaaa"), "a", "b0")
+	is.NoErr(err)
+	_, err = s.PutObject(strings.NewReader("bbbbb"), "b", "b0")
+	is.Equal(err, ErrQuotaExceeded)
+	_, ok := d.Object("b0", "b")
+	is.False(ok)
+
+	// a reader of unknown size is removed again once it is found too big
+	_, err = s.PutObject(ioutil.NopCloser(strings.NewReader("ccccc")), "c", "b0")
+	is.Equal(err, ErrQuotaExceeded)
+	_, ok = d.Object("b0", "c")
+	is.False(ok)
+
+	_, err = s.PutObject(strings.NewReader("dd"), "d", "b0")
+	is.NoErr(err)
+	_, err = s.PutObject(strings.NewReader("e"), "e", "b0")
+	is.Equal(err, ErrQuotaExceeded)
+
+	// usage is not taken from a stale listing
+	is.NoErr(s.SetBucketQuota("b0", BucketQuota{MaxSize: 8}))
+	s.EnableMetaCache(10, time.Hour)
+	_, err = s.ListObjects("b0")
+	is.NoErr(err)
+	d.Put("b0", "f", []byte("ff"), time.Now())
+	_, err = s.PutObject(strings.NewReader("g"), "g", "b0")
+	is.Equal(err, ErrQuotaExceeded)
+
+	// a failed cleanup is reported
+	d.Handle("lfs/delete_object", func(w http.ResponseWriter, r *http.Request) {
+		fakedaemon.Error(w, "daemon busy")
+	})
+	_, err = s.PutObject(ioutil.NopCloser(strings.NewReader("hhh")), "h", "b0")
+	is.True(errors.Is(err, ErrQuotaExceeded))
+	is.True(strings.Contains(err.Error(), "daemon busy"))
+
+	// buckets without a quota are not looked at, and a quota that can not
+	// be read does not stop uploads
+	_, err = s.CreateBucket("b1")
+	is.NoErr(err)
+	lists := countCalls(d, "lfs/list_objects")
+	_, err = s.PutObject(strings.NewReader("iiiiiiiiii"), "i", "b1")
+	is.NoErr(err)
+	is.True(countCalls(d, "lfs/list_objects") <= lists+1)
+	d.Handle("lfs/list_objects", func(w http.ResponseWriter, r *http.Request) {
+		fakedaemon.Error(w, "daemon busy")
+	})
+	s.EnableMetaCache(0, 0)
+	_, err = s.PutObject(strings.NewReader("jjjjjjjjjj"), "j", "b0")
+	is.NoErr(err)
+}
+
+func TestLifecycleSweep(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	_, err := s.CreateBucket("b0")
+	is.NoErr(err)
+	is.NoErr(s.SetBucketLifecycle("b0", []LifecycleRule{
+		{ID: "logs", Prefix: "logs/", ExpireDays: 1},
+		{ID: "all", ExpireDays: 30},
+	}))
+
+	old := time.Now().Add(-48 * time.Hour)
+	ancient := time.Now().Add(-60 * 24 * time.Hour)
+	d.Put("b0", "logs/old", []byte("x"), old)
+	d.Put("b0", "logs/new", []byte("x"), time.Now())
+	d.Put("b0", "data/old", []byte("x"), old)
+	d.Put("b0", "data/ancient", []byte("x"), ancient)
+
+	res, err := s.NewLifecycleSweeper(time.Hour).Sweep(context.Background(), "b0")
+	is.NoErr(err)
+	is.Equal(len(res.Errors), 0)
+	is.Equal(res.Deleted, []string{"logs/old", "data/ancient"})
+
+	_, ok := d.Object("b0", BucketMetaObject)
+	is.True(ok)
+	_, ok = d.Object("b0", "data/old")
+	is.True(ok)
+
+	is.Err(s.NewLifecycleSweeper(0).Run(context.Background()))
+}
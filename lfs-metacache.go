@@ -0,0 +1,249 @@
+package shell
+
+import (
+	"container/list"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetaCacheStats counts how the metadata cache has been doing.
+type MetaCacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	// Entries is the number of answers cached right now.
+	Entries int
+}
+
+// HitRate returns the share of lookups answered from the cache.
+func (st MetaCacheStats) HitRate() float64 {
+	if st.Hits+st.Misses == 0 {
+		return 0
+	}
+	return float64(st.Hits) / float64(st.Hits+st.Misses)
+}
+
+// EnableMetaCache makes HeadObject and ListObjects remember up to size
+// answers for ttl. Objects put, copied, moved or deleted through the Shell,
+// and buckets created or deleted through it, are dropped from the cache;
+// changes made by other clients show up once the ttl has passed. A size or
+// ttl of zero disables the cache.
+func (s *Shell) EnableMetaCache(size int, ttl time.Duration) {
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+	if size <= 0 || ttl <= 0 {
+		s.metaCache = nil
+		return
+	}
+	s.metaCache = newMetaCache(size, ttl)
+}
+
+// MetaCacheStats returns the statistics of the metadata cache, which are
+// zero if it is not enabled.
+func (s *Shell) MetaCacheStats() MetaCacheStats {
+	mc := s.getMetaCache()
+	if mc == nil {
+		return MetaCacheStats{}
+	}
+	return mc.stats()
+}
+
+func (s *Shell) getMetaCache() *metaCache {
+	s.metaMu.RLock()
+	defer s.metaMu.RUnlock()
+	return s.metaCache
+}
+
+// invalidateMeta drops what the cache knows about an object of a bucket,
+// and every listing of the bucket. An empty object drops the whole bucket.
+func (s *Shell) invalidateMeta(rb *RequestBuilder, bucket, object string) {
+	if mc := s.getMetaCache(); mc != nil {
+		mc.invalidate(rb.opts["address"], bucket, object)
+	}
+}
+
+// cachedObjects answers the request rb, for an object of a bucket or for
+// its listing if object is empty, from the cache or else with fetch.
+func (s *Shell) cachedObjects(rb *RequestBuilder, bucket, object string, fetch func() (*Objects, error)) (*Objects, error) {
+	mc := s.getMetaCache()
+	if mc == nil {
+		return fetch()
+	}
+	key := metaKey{
+		address: rb.opts["address"],
+		bucket:  bucket,
+		object:  object,
+		list:    object == "",
+		opts:    encodeOpts(rb.opts),
+	}
+	if objs, ok := mc.get(key); ok {
+		return objs, nil
+	}
+	// fetch runs unlocked, so a change made meanwhile may leave its answer
+	// stale; put skips it then
+	gen := mc.generation(key)
+	objs, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	mc.put(key, objs, gen)
+	return objs, nil
+}
+
+// encodeOpts flattens the options other than the address, which changes
+// the answer too but is keyed on separately.
+func encodeOpts(opts map[string]string) string {
+	keys := make([]string, 0, len(opts))
+	for k := range opts {
+		if k != "address" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(opts[k])
+		b.WriteByte('&')
+	}
+	return b.String()
+}
+
+type metaKey struct {
+	address string
+	bucket  string
+	object  string
+	list    bool
+	opts    string
+}
+
+// metaBucket is a bucket of a user, the unit the cache is invalidated in.
+type metaBucket struct {
+	address string
+	bucket  string
+}
+
+type metaEntry struct {
+	key     metaKey
+	objs    *Objects
+	expires time.Time
+}
+
+// metaCache is an LRU cache of HeadObject and ListObjects answers whose
+// entries also expire after a ttl.
+type metaCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	lru     *list.List
+	entries map[metaKey]*list.Element
+	// gens counts the invalidations of every bucket.
+	gens map[metaBucket]uint64
+	st   MetaCacheStats
+}
+
+func newMetaCache(size int, ttl time.Duration) *metaCache {
+	return &metaCache{
+		size:    size,
+		ttl:     ttl,
+		lru:     list.New(),
+		entries: make(map[metaKey]*list.Element),
+		gens:    make(map[metaBucket]uint64),
+	}
+}
+
+func (mc *metaCache) get(key metaKey) (*Objects, bool) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	el, ok := mc.entries[key]
+	if ok && time.Now().After(el.Value.(*metaEntry).expires) {
+		mc.remove(el)
+		ok = false
+	}
+	if !ok {
+		mc.st.Misses++
+		return nil, false
+	}
+	mc.st.Hits++
+	mc.lru.MoveToFront(el)
+	return copyObjects(el.Value.(*metaEntry).objs), true
+}
+
+// generation returns how often the bucket of key has been invalidated, to
+// be handed to put.
+func (mc *metaCache) generation(key metaKey) uint64 {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.gens[metaBucket{key.address, key.bucket}]
+}
+
+// put caches objs unless the bucket of key was invalidated since gen was
+// taken.
+func (mc *metaCache) put(key metaKey, objs *Objects, gen uint64) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.gens[metaBucket{key.address, key.bucket}] != gen {
+		return
+	}
+	e := &metaEntry{key: key, objs: copyObjects(objs), expires: time.Now().Add(mc.ttl)}
+	if el, ok := mc.entries[key]; ok {
+		el.Value = e
+		mc.lru.MoveToFront(el)
+		return
+	}
+	mc.entries[key] = mc.lru.PushFront(e)
+	for mc.lru.Len() > mc.size {
+		mc.remove(mc.lru.Back())
+		mc.st.Evictions++
+	}
+}
+
+func (mc *metaCache) invalidate(address, bucket, object string) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.gens[metaBucket{address, bucket}]++
+	for key, el := range mc.entries {
+		if key.address != address || key.bucket != bucket {
+			continue
+		}
+		if object == "" || key.list || key.object == object {
+			mc.remove(el)
+		}
+	}
+}
+
+func (mc *metaCache) remove(el *list.Element) {
+	mc.lru.Remove(el)
+	delete(mc.entries, el.Value.(*metaEntry).key)
+}
+
+func (mc *metaCache) stats() MetaCacheStats {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	st := mc.st
+	st.Entries = mc.lru.Len()
+	return st
+}
+
+// copyObjects copies objs deeply enough that callers may change what they
+// get without touching the cache.
+func copyObjects(objs *Objects) *Objects {
+	cp := &Objects{Method: objs.Method}
+	if objs.Objects != nil {
+		cp.Objects = make([]ObjectStat, len(objs.Objects))
+		for i, ob := range objs.Objects {
+			if ob.Metadata != nil {
+				meta := make(map[string]string, len(ob.Metadata))
+				for k, v := range ob.Metadata {
+					meta[k] = v
+				}
+				ob.Metadata = meta
+			}
+			cp.Objects[i] = ob
+		}
+	}
+	return cp
+}
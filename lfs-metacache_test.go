@@ -0,0 +1,141 @@
+package shell
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+)
+
+func countCalls(d *fakeDaemon, cmd string) int {
+	n := 0
+	for _, c := range d.Calls() {
+		if c == cmd {
+			n++
+		}
+	}
+	return n
+}
+
+func TestMetaCache(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+	s.EnableMetaCache(2, time.Minute)
+
+	_, err := s.CreateBucket("b0")
+	is.NoErr(err)
+	d.Put("b0", "a", []byte("aaa"), time.Now())
+	d.Put("b0", "b", []byte("bb"), time.Now())
+
+	objs, err := s.HeadObject("a", "b0")
+	is.NoErr(err)
+	is.Equal(objs.Objects[0].ObjectSize, int64(3))
+	// changing the answer must not change the cache
+	objs.Objects[0].ObjectSize = 42
+	objs, err = s.HeadObject("a", "b0")
+	is.NoErr(err)
+	is.Equal(objs.Objects[0].ObjectSize, int64(3))
+	is.Equal(countCalls(d, "lfs/head_object"), 1)
+
+	// other users do not share entries
+	_, err = s.HeadObject("a", "b0", SetAddress("other"))
+	is.NoErr(err)
+	is.Equal(countCalls(d, "lfs/head_object"), 2)
+
+	list, err := s.ListObjects("b0")
+	is.NoErr(err)
+	is.Equal(len(list.Objects), 2)
+	_, err = s.ListObjects("b0", SortObjects(OrderBySize, false))
+	is.NoErr(err)
+	is.Equal(countCalls(d, "lfs/list_objects"), 1)
+
+	// a put drops the listings of its bucket
+	_, err = s.PutObject(bytes.NewReader([]byte("ccccc")), "c", "b0")
+	is.NoErr(err)
+	lists := countCalls(d, "lfs/list_objects")
+	list, err = s.ListObjects("b0")
+	is.NoErr(err)
+	is.Equal(len(list.Objects), 3)
+	is.Equal(countCalls(d, "lfs/list_objects"), lists+1)
+
+	// a delete drops the object too
+	_, err = s.HeadObject("b", "b0")
+	is.NoErr(err)
+	_, err = s.DeleteObject("b", "b0")
+	is.NoErr(err)
+	_, err = s.HeadObject("b", "b0")
+	is.Err(err)
+	list, err = s.ListObjects("b0")
+	is.NoErr(err)
+	is.Equal(len(list.Objects), 2)
+
+	st := s.MetaCacheStats()
+	is.Equal(st.Hits, int64(2))
+	is.True(st.Evictions > 0)
+	is.True(st.Entries <= 2)
+
+	_, err = s.DeleteBucket("b0", Recursive(true))
+	is.NoErr(err)
+	_, err = s.ListObjects("b0")
+	is.Err(err)
+
+	s.EnableMetaCache(0, 0)
+	is.Equal(s.MetaCacheStats(), MetaCacheStats{})
+}
+
+func TestMetaCacheExpiry(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+	s.EnableMetaCache(10, 20*time.Millisecond)
+
+	_, err := s.CreateBucket("b0")
+	is.NoErr(err)
+	d.Put("b0", "a", []byte("aaa"), time.Now())
+
+	_, err = s.HeadObject("a", "b0")
+	is.NoErr(err)
+	// written behind the client's back
+	d.Put("b0", "a", []byte("a"), time.Now())
+	objs, err := s.HeadObject("a", "b0")
+	is.NoErr(err)
+	is.Equal(objs.Objects[0].ObjectSize, int64(3))
+
+	time.Sleep(30 * time.Millisecond)
+	objs, err = s.HeadObject("a", "b0")
+	is.NoErr(err)
+	is.Equal(objs.Objects[0].ObjectSize, int64(1))
+	is.Equal(s.MetaCacheStats().Misses, int64(2))
+}
+
+func TestMetaCacheRace(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+	s.EnableMetaCache(10, time.Minute)
+
+	_, err := s.CreateBucket("b0")
+	is.NoErr(err)
+	d.Put("b0", "a", []byte("aaa"), time.Now())
+
+	// the object is deleted while its stat is on the way
+	d.Handle("lfs/head_object", func(w http.ResponseWriter, r *http.Request) {
+		d.Builtin(w, r)
+		d.Handle("lfs/head_object", nil)
+		_, err := s.DeleteObject("a", "b0")
+		is.NoErr(err)
+	})
+	_, err = s.HeadObject("a", "b0")
+	is.NoErr(err)
+
+	// the stale answer was not cached
+	_, err = s.HeadObject("a", "b0")
+	is.Err(err)
+	is.Equal(countCalls(d, "lfs/head_object"), 2)
+}
@@ -3,22 +3,29 @@ package shell
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
+	"sort"
+	"strconv"
+	"strings"
 
 	files "github.com/ipfs/go-ipfs/source/go-ipfs-files"
 )
 
 type ObjectStat struct {
 	ObjectName     string
-	ObjectSize     int32
+	ObjectSize     int64
 	MD5            string
-	Ctime          string
+	Ctime          Time
 	Dir            bool
-	LatestChalTime string
+	LatestChalTime Time
+	SHA256         string
+	ContentType    string
+	Metadata       map[string]string
 }
 
 type Objects struct {
@@ -28,9 +35,55 @@ type Objects struct {
 
 var (
 	errLfsServiceNotReady   = errors.New("lfs service not ready")
-	errGroupServiceNotReady = errors.New("group service not ready")
+	ErrGroupServiceNotReady = errors.New("group service not ready")
+
+	ErrMD5Mismatch    = errors.New("md5 mismatch")
+	ErrSHA256Mismatch = errors.New("sha256 mismatch")
 )
 
+// UnmarshalJSON accepts ObjectSize both as a number and as a string, which
+// is how daemons send sizes that do not fit a JSON number exactly.
+func (ob *ObjectStat) UnmarshalJSON(b []byte) error {
+	type objectStat ObjectStat
+	aux := struct {
+		*objectStat
+		ObjectSize json.Number
+	}{objectStat: (*objectStat)(ob)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	return ob.setSize(string(aux.ObjectSize))
+}
+
+func (ob *ObjectStat) unmarshalCBOR(d *cborDecoder) error {
+	type objectStat ObjectStat
+	aux := struct {
+		*objectStat
+		ObjectSize cborItem
+	}{objectStat: (*objectStat)(ob)}
+	if err := d.into(&aux); err != nil {
+		return err
+	}
+	size, ok := cborText(aux.ObjectSize.v)
+	if !ok && aux.ObjectSize.v != nil {
+		return fmt.Errorf("invalid object size %v", aux.ObjectSize.v)
+	}
+	return ob.setSize(size)
+}
+
+func (ob *ObjectStat) setSize(size string) error {
+	ob.ObjectSize = 0
+	if size == "" {
+		return nil
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid object size %q: %s", size, err)
+	}
+	ob.ObjectSize = n
+	return nil
+}
+
 func (ob ObjectStat) String() string {
 	FloatStorage := float64(ob.ObjectSize)
 	var OutStorage string
@@ -43,7 +96,7 @@ func (ob ObjectStat) String() string {
 	} else {
 		OutStorage = fmt.Sprintf("%.2f", FloatStorage/1073741824) + "GB"
 	}
-	return fmt.Sprintf(
+	str := fmt.Sprintf(
 		"ObjectName: %s\n--ObjectSize: %s\n--MD5: %s\n--Ctime: %s\n--Dir: %t\n--LatestChalTime: %s\n",
 		ob.ObjectName,
 		OutStorage,
@@ -52,6 +105,18 @@ func (ob ObjectStat) String() string {
 		ob.Dir,
 		ob.LatestChalTime,
 	)
+	if ob.ContentType != "" {
+		str += "--ContentType: " + ob.ContentType + "\n"
+	}
+	keys := make([]string, 0, len(ob.Metadata))
+	for k := range ob.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		str += "--Metadata: " + k + "=" + ob.Metadata[k] + "\n"
+	}
+	return str
 }
 
 func (obs Objects) String() string {
@@ -64,29 +129,118 @@ func (obs Objects) String() string {
 }
 
 func (s *Shell) HeadObject(ObjectName, BucketName string, options ...LfsOpts) (*Objects, error) {
-	var objs Objects
 	rb := s.Request("lfs/head_object", BucketName, ObjectName)
 	for _, option := range options {
-		option(rb)
+		if err := option(rb); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.cachedObjects(rb, BucketName, ObjectName, func() (*Objects, error) {
+		var objs Objects
+		if err := rb.Exec(context.Background(), &objs); err != nil {
+			return nil, err
+		}
+		return &objs, nil
+	})
+}
+
+// headObject is HeadObject without the metadata cache, for the checks that
+// must see the object as it is now. The options of GetObject may be passed
+// as they are: a range only means something to get_object and is dropped.
+func (s *Shell) headObject(ObjectName, BucketName string, options ...LfsOpts) (*Objects, error) {
+	rb := s.Request("lfs/head_object", BucketName, ObjectName)
+	for _, option := range options {
+		if err := option(rb); err != nil {
+			return nil, err
+		}
 	}
+	delete(rb.opts, "offset")
+	delete(rb.opts, "length")
 
+	var objs Objects
 	if err := rb.Exec(context.Background(), &objs); err != nil {
 		return nil, err
 	}
 	return &objs, nil
 }
 
+// GetObject downloads an object. Unless VerifyChecksums(false) is given the
+// object's checksums are looked up first and the returned reader fails with
+// ErrMD5Mismatch or ErrSHA256Mismatch at EOF if the data does not match.
+// With EnableContentCache the object may be read from the local cache.
+// SetRange downloads part of the object, unverified.
 func (s *Shell) GetObject(ObjectName, BucketName string, options ...LfsOpts) (io.ReadCloser, error) {
 	var err error
 	rb := s.Request("lfs/get_object", BucketName, ObjectName)
 	for _, option := range options {
-		option(rb)
+		if err := option(rb); err != nil {
+			return nil, err
+		}
 	}
+
+	wantMD5, wantSHA256 := rb.lfs.expectMD5, rb.lfs.expectSHA256
+	cache := s.getContentCache()
+	var cacheName, cacheMD5 string
+	verify := !rb.lfs.skipVerify && !rb.lfs.ranged
+	if verify || cache != nil {
+		objs, err := s.headObject(ObjectName, BucketName, options...)
+		if err != nil {
+			return nil, err
+		}
+		if len(objs.Objects) > 0 {
+			stat := objs.Objects[0]
+			if cache != nil && stat.MD5 != "" {
+				cacheName = contentKey(rb.opts["address"], BucketName, ObjectName, stat.MD5)
+				cacheMD5 = stat.MD5
+			}
+			// no need to download what we already know is wrong
+			if verify && stat.MD5 != "" {
+				if wantMD5 != "" && !strings.EqualFold(wantMD5, stat.MD5) {
+					return nil, ErrMD5Mismatch
+				}
+				wantMD5 = stat.MD5
+			}
+			if verify && stat.SHA256 != "" {
+				if wantSHA256 != "" && !strings.EqualFold(wantSHA256, stat.SHA256) {
+					return nil, ErrSHA256Mismatch
+				}
+				wantSHA256 = stat.SHA256
+			}
+		}
+	}
+
+	if cacheName != "" {
+		if f, ok := cache.open(cacheName); ok {
+			if rb.lfs.ranged {
+				return cachedRange(f, rb.lfs.rangeOffset, rb.lfs.rangeLength)
+			}
+			// the file was checked when it was cached, but disks rot
+			if wantMD5 == "" {
+				wantMD5 = cacheMD5
+			}
+			return &cachedReader{newVerifyingReader(f, wantMD5, wantSHA256), cache, cacheName}, nil
+		}
+	}
+
 	resp, err := rb.Send(context.Background())
 	if err != nil {
 		return nil, err
 	}
-	return resp.Output, err
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	var r io.ReadCloser = resp.Output
+	if rb.lfs.ranged {
+		return r, nil
+	}
+	if wantMD5 != "" || wantSHA256 != "" {
+		r = newVerifyingReader(r, wantMD5, wantSHA256)
+	}
+	if cacheName != "" {
+		r = cache.fill(cacheName, cacheMD5, r)
+	}
+	return r, nil
 }
 
 func (s *Shell) GetObjectToFile(ObjectName, BucketName, outPath string, options ...LfsOpts) error {
@@ -108,6 +262,13 @@ func (s *Shell) GetObjectToFile(ObjectName, BucketName, outPath string, options
 	} else {
 		return errors.New("The outpath already has file: " + ObjectName)
 	}
+
+	r, err := s.GetObject(ObjectName, BucketName, options...)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
 	var file *os.File
 	if _, err := os.Stat(p); err != nil && os.IsNotExist(err) {
 		file, err = os.Create(p)
@@ -120,61 +281,288 @@ func (s *Shell) GetObjectToFile(ObjectName, BucketName, outPath string, options
 
 	defer file.Close()
 
-	rb := s.Request("lfs/get_object", BucketName, ObjectName)
-	for _, option := range options {
-		option(rb)
+	if _, err := io.Copy(file, r); err != nil {
+		// don't leave a truncated or corrupt file behind
+		file.Close()
+		os.Remove(p)
+		return err
 	}
-	resp, err := rb.Send(context.Background())
+	return file.Close()
+}
+
+// ListObjects lists the objects of a bucket. SortObjects, CreatedBetween and
+// SizeBetween are applied to the daemon's answer by the client.
+func (s *Shell) ListObjects(BucketName string, options ...LfsOpts) (*Objects, error) {
+	local, err := localOptions(options)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	written, err := io.Copy(file, resp.Output)
+	objs, err := s.listObjects(BucketName, options...)
 	if err != nil {
-		fmt.Println("Download", ObjectName, " err", err)
+		return nil, err
+	}
+	visible := objs.Objects[:0]
+	for _, ob := range objs.Objects {
+		if !isBucketMetaObject(ob.ObjectName) && local.match(ob) {
+			visible = append(visible, ob)
+		}
 	}
-	fmt.Println("Download", ObjectName, "finish, write data", written)
-	return err
+	objs.Objects = visible
+	local.sort(objs.Objects)
+	return objs, nil
 }
 
-func (s *Shell) ListObjects(BucketName string, options ...LfsOpts) (*Objects, error) {
-	var objs Objects
+func (lo lfsOptions) match(ob ObjectStat) bool {
+	if !lo.createdAfter.IsZero() || !lo.createdBefore.IsZero() {
+		if ob.Ctime.IsZero() {
+			return false
+		}
+		if !lo.createdAfter.IsZero() && ob.Ctime.Before(lo.createdAfter) {
+			return false
+		}
+		if !lo.createdBefore.IsZero() && !ob.Ctime.Before(lo.createdBefore) {
+			return false
+		}
+	}
+	if ob.ObjectSize < lo.minSize || (lo.maxSize > 0 && ob.ObjectSize > lo.maxSize) {
+		return false
+	}
+	return true
+}
+
+func (lo lfsOptions) sort(obs []ObjectStat) {
+	var less func(a, b ObjectStat) bool
+	switch lo.order {
+	case OrderByName:
+		less = func(a, b ObjectStat) bool { return a.ObjectName < b.ObjectName }
+	case OrderByCtime:
+		less = func(a, b ObjectStat) bool { return a.Ctime.Before(b.Ctime.Time) }
+	case OrderBySize:
+		less = func(a, b ObjectStat) bool { return a.ObjectSize < b.ObjectSize }
+	default:
+		return
+	}
+	sort.SliceStable(obs, func(i, j int) bool {
+		if lo.descending {
+			return less(obs[j], obs[i])
+		}
+		return less(obs[i], obs[j])
+	})
+}
+
+// listObjects is ListObjects without hiding the objects the client keeps
+// for itself.
+func (s *Shell) listObjects(BucketName string, options ...LfsOpts) (*Objects, error) {
 	rb := s.Request("lfs/list_objects", BucketName)
 	for _, option := range options {
-		option(rb)
+		if err := option(rb); err != nil {
+			return nil, err
+		}
 	}
 
-	if err := rb.Exec(context.Background(), &objs); err != nil {
-		return nil, err
-	}
-	return &objs, nil
+	return s.cachedObjects(rb, BucketName, "", func() (*Objects, error) {
+		var objs Objects
+		if err := rb.Exec(context.Background(), &objs); err != nil {
+			return nil, err
+		}
+		return &objs, nil
+	})
 }
 
+// PutObject uploads an object. The data is hashed as it is sent and, unless
+// VerifyChecksums(false) is given, the upload fails with ErrMD5Mismatch if
+// the daemon stored something else. It fails the same way if the data does
+// not match ExpectMD5 or ExpectSHA256; either way the object is deleted
+// again. The SHA-256 of the data is filled in if the daemon does not report
+// one. If the bucket has a quota the upload fails with ErrQuotaExceeded when
+// the object does not fit; when the size of r cannot be told beforehand the
+// object is deleted again. A quota that cannot be checked is not enforced.
 func (s *Shell) PutObject(r io.Reader, ObjectName, BucketName string, options ...LfsOpts) (*Objects, error) {
-	fr := files.NewReaderFile(r)
+	size, sized := readerSize(r)
+	var quota *BucketQuota
+	if !isBucketMetaObject(ObjectName) {
+		quota = s.uploadQuota(BucketName, options...)
+	}
+	if quota != nil {
+		if err := s.checkQuota(quota, BucketName, size, 1, options...); err == ErrQuotaExceeded {
+			return nil, err
+		}
+	}
+
+	hr := newHashReader(r)
+	fr := files.NewReaderFile(hr)
 	slf := files.NewSliceDirectory([]files.DirEntry{files.FileEntry("", fr)})
 	fileReader := files.NewMultiFileReader(slf, true)
 	var objs Objects
 	rb := s.Request("lfs/put_object", BucketName, ObjectName)
 	for _, option := range options {
-		option(rb)
+		if err := option(rb); err != nil {
+			return nil, err
+		}
 	}
 	rb.Option("objectname", ObjectName)
 	rb = rb.Body(fileReader)
+	defer s.invalidateMeta(rb, BucketName, ObjectName)
 	if err := rb.Exec(context.Background(), &objs); err != nil {
+		// report why the source failed rather than the aborted request
+		if hr.err != nil {
+			return nil, hr.err
+		}
+		if isGroupNotReady(err) {
+			return nil, ErrGroupServiceNotReady
+		}
 		return nil, err
 	}
+
+	// what fails verification is not left behind in the bucket
+	md5Sum, sha256Sum := hr.MD5(), hr.SHA256()
+	if err := verifySums(md5Sum, sha256Sum, rb.lfs.expectMD5, rb.lfs.expectSHA256); err != nil {
+		s.DeleteObject(ObjectName, BucketName, options...)
+		return nil, err
+	}
+	for i := range objs.Objects {
+		stat := &objs.Objects[i]
+		if stat.ObjectName != ObjectName && stat.ObjectName != "" {
+			continue
+		}
+		if !rb.lfs.skipVerify {
+			if err := verifySums(md5Sum, sha256Sum, stat.MD5, stat.SHA256); err != nil {
+				s.DeleteObject(ObjectName, BucketName, options...)
+				return nil, err
+			}
+		}
+		if stat.SHA256 == "" {
+			stat.SHA256 = sha256Sum
+		}
+	}
+
+	if quota != nil && !sized {
+		if err := s.checkQuota(quota, BucketName, 0, 0, options...); err == ErrQuotaExceeded {
+			if _, derr := s.DeleteObject(ObjectName, BucketName, options...); derr != nil {
+				return nil, fmt.Errorf("%w, and removing %s failed: %s", err, ObjectName, derr)
+			}
+			return nil, err
+		}
+	}
 	return &objs, nil
 }
 
+// readerSize returns how much is left to read from r, if r can tell.
+func readerSize(r io.Reader) (int64, bool) {
+	switch r := r.(type) {
+	case interface{ Len() int }:
+		return int64(r.Len()), true
+	case *os.File:
+		fi, err := r.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			return 0, false
+		}
+		off, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		return fi.Size() - off, true
+	}
+	return 0, false
+}
+
 func (s *Shell) DeleteObject(ObjectName, BucketName string, options ...LfsOpts) (*Objects, error) {
 	var objs Objects
-	rb := s.Request("lfs/delete_object", BucketName)
+	rb := s.Request("lfs/delete_object", BucketName, ObjectName)
 	for _, option := range options {
-		option(rb)
+		if err := option(rb); err != nil {
+			return nil, err
+		}
 	}
+	defer s.invalidateMeta(rb, BucketName, ObjectName)
 
 	if err := rb.Exec(context.Background(), &objs); err != nil {
 		return nil, err
 	}
 	return &objs, nil
 }
+
+// CopyObject copies an object, possibly into another bucket of the same
+// user. If the daemon cannot copy by itself the object is streamed through
+// the client and its MD5 checked against the source.
+func (s *Shell) CopyObject(srcBucket, srcName, dstBucket, dstName string, options ...LfsOpts) (*Objects, error) {
+	var objs Objects
+	rb := s.Request("lfs/copy_object", srcBucket, srcName, dstBucket, dstName)
+	for _, option := range options {
+		if err := option(rb); err != nil {
+			return nil, err
+		}
+	}
+	defer s.invalidateMeta(rb, dstBucket, dstName)
+	err := rb.Exec(context.Background(), &objs)
+	if isCommandNotFound(err) {
+		return s.copyObject(srcBucket, srcName, dstBucket, dstName, options...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &objs, nil
+}
+
+// MoveObject moves or renames an object. Like CopyObject it falls back to
+// streaming through the client, deleting the source only once the copy has
+// been verified.
+func (s *Shell) MoveObject(srcBucket, srcName, dstBucket, dstName string, options ...LfsOpts) (*Objects, error) {
+	var objs Objects
+	rb := s.Request("lfs/move_object", srcBucket, srcName, dstBucket, dstName)
+	for _, option := range options {
+		if err := option(rb); err != nil {
+			return nil, err
+		}
+	}
+	defer s.invalidateMeta(rb, srcBucket, srcName)
+	defer s.invalidateMeta(rb, dstBucket, dstName)
+	err := rb.Exec(context.Background(), &objs)
+	if !isCommandNotFound(err) {
+		if err != nil {
+			return nil, err
+		}
+		return &objs, nil
+	}
+
+	dst, err := s.copyObject(srcBucket, srcName, dstBucket, dstName, options...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.DeleteObject(srcName, srcBucket, options...); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+func (s *Shell) copyObject(srcBucket, srcName, dstBucket, dstName string, options ...LfsOpts) (*Objects, error) {
+	src, err := s.HeadObject(srcName, srcBucket, options...)
+	if err != nil {
+		return nil, err
+	}
+	if len(src.Objects) == 0 {
+		return nil, errors.New("no such object: " + srcName)
+	}
+	stat := src.Objects[0]
+
+	r, err := s.GetObject(srcName, srcBucket, options...)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	putOpts := append([]LfsOpts{}, options...)
+	if stat.ContentType != "" {
+		putOpts = append(putOpts, SetContentType(stat.ContentType))
+	}
+	if len(stat.Metadata) > 0 {
+		putOpts = append(putOpts, SetMetadata(stat.Metadata))
+	}
+	// GetObject checks the data against the source and PutObject checks
+	// what the daemon stored against the data, deleting it on a mismatch.
+	dst, err := s.PutObject(r, dstName, dstBucket, putOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
@@ -0,0 +1,237 @@
+package shell
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+	"github.com/xcshuan/go-mefs-api/internal/fakedaemon"
+)
+
+func TestPutObjectMetadata(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	_, err := s.CreateBucket("b0")
+	is.NoErr(err)
+
+	meta := map[string]string{"author": "alice", "lang": "en"}
+	_, err = s.PutObject(bytes.NewBufferString("<p>hi</p>"), "index.html", "b0",
+		SetContentType("text/html; charset=utf-8"),
+		SetMetadata(meta),
+	)
+	is.NoErr(err)
+
+	objs, err := s.HeadObject("index.html", "b0")
+	is.NoErr(err)
+	is.Equal(objs.Objects[0].ContentType, "text/html; charset=utf-8")
+	is.Equal(objs.Objects[0].Metadata, meta)
+
+	objs, err = s.ListObjects("b0")
+	is.NoErr(err)
+	is.Equal(objs.Objects[0].Metadata, meta)
+
+	_, err = s.PutObject(bytes.NewBufferString("x"), "x", "b0", SetContentType("not a type"))
+	is.Err(err)
+	_, err = s.PutObject(bytes.NewBufferString("x"), "x", "b0", SetMetadata(map[string]string{"": "v"}))
+	is.Err(err)
+}
+
+func TestCopyAndMoveObjectFallback(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	_, err := s.CreateBucket("b0")
+	is.NoErr(err)
+	_, err = s.CreateBucket("b1")
+	is.NoErr(err)
+	_, err = s.PutObject(bytes.NewBufferString("payload"), "a", "b0", SetContentType("text/plain"))
+	is.NoErr(err)
+
+	objs, err := s.CopyObject("b0", "a", "b1", "copy")
+	is.NoErr(err)
+	is.Equal(objs.Objects[0].ObjectName, "copy")
+	is.Equal(objs.Objects[0].ContentType, "text/plain")
+	data, ok := d.Object("b1", "copy")
+	is.True(ok)
+	is.Equal(string(data), "payload")
+
+	_, err = s.MoveObject("b0", "a", "b0", "renamed")
+	is.NoErr(err)
+	_, ok = d.Object("b0", "a")
+	is.False(ok)
+	data, ok = d.Object("b0", "renamed")
+	is.True(ok)
+	is.Equal(string(data), "payload")
+}
+
+func TestCopyObjectMD5Mismatch(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	_, err := s.CreateBucket("b0")
+	is.NoErr(err)
+	d.Put("b0", "a", []byte("payload"), time.Now())
+	// serve different bytes than the object's MD5 describes
+	d.Handle("lfs/get_object", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("corrupt"))
+	})
+
+	_, err = s.CopyObject("b0", "a", "b0", "copy")
+	is.Equal(err, ErrMD5Mismatch)
+	_, ok := d.Object("b0", "copy")
+	is.False(ok)
+}
+
+func TestPutObjectVerifiesMD5(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	_, err := s.CreateBucket("b0")
+	is.NoErr(err)
+
+	objs, err := s.PutObject(bytes.NewBufferString("payload"), "a", "b0")
+	is.NoErr(err)
+	is.Equal(objs.Objects[0].SHA256, "239f59ed55e737c77147cf55ad0c1b030b6d7ee748a7426952f9b852d5a935e5")
+
+	_, err = s.PutObject(bytes.NewBufferString("payload"), "b", "b0", ExpectSHA256(strings.Repeat("0", 64)))
+	is.Equal(err, ErrSHA256Mismatch)
+	_, ok := d.Object("b0", "b")
+	is.False(ok)
+
+	d.Handle("lfs/put_object", func(w http.ResponseWriter, r *http.Request) {
+		d.Builtin(httptest.NewRecorder(), r)
+		fakedaemon.JSON(w, Objects{Objects: []ObjectStat{{ObjectName: "c", MD5: strings.Repeat("0", 32)}}})
+	})
+	_, err = s.PutObject(bytes.NewBufferString("payload"), "c", "b0")
+	is.Equal(err, ErrMD5Mismatch)
+	_, ok = d.Object("b0", "c")
+	is.False(ok)
+	_, err = s.PutObject(bytes.NewBufferString("payload"), "c", "b0", VerifyChecksums(false))
+	is.NoErr(err)
+}
+
+func TestGetObjectVerifies(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	d.Put("b0", "a", []byte("payload"), time.Now())
+
+	r, err := s.GetObject("a", "b0")
+	is.NoErr(err)
+	data, err := ioutil.ReadAll(r)
+	is.NoErr(err)
+	is.Equal(string(data), "payload")
+	r.Close()
+
+	d.Handle("lfs/get_object", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("corrupt"))
+	})
+	r, err = s.GetObject("a", "b0")
+	is.NoErr(err)
+	_, err = ioutil.ReadAll(r)
+	is.Equal(err, ErrMD5Mismatch)
+	r.Close()
+
+	dir, err := ioutil.TempDir("", "mefs-get")
+	is.NoErr(err)
+	defer os.RemoveAll(dir)
+	is.Equal(s.GetObjectToFile("a", "b0", dir), ErrMD5Mismatch)
+	_, err = os.Stat(filepath.Join(dir, "a"))
+	is.True(os.IsNotExist(err))
+
+	r, err = s.GetObject("a", "b0", VerifyChecksums(false))
+	is.NoErr(err)
+	data, err = ioutil.ReadAll(r)
+	is.NoErr(err)
+	is.Equal(string(data), "corrupt")
+	r.Close()
+}
+
+func TestGetObjectRange(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	d.Put("b0", "a", []byte("0123456789"), time.Now())
+	for _, c := range []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, 4, "0123"},
+		{6, 0, "6789"},
+		{8, 10, "89"},
+	} {
+		r, err := s.GetObject("a", "b0", SetRange(c.offset, c.length))
+		is.NoErr(err)
+		data, err := ioutil.ReadAll(r)
+		is.NoErr(err)
+		is.Equal(string(data), c.want)
+		r.Close()
+	}
+	// a range can not be checked, so the head is not looked up
+	is.Equal(countCalls(d, "lfs/head_object"), 0)
+
+	_, err := s.GetObject("a", "b0", SetRange(-1, 0))
+	is.Err(err)
+
+	// with a content cache the head is looked up, but not for a range
+	dir, err := ioutil.TempDir("", "mefs-cache")
+	is.NoErr(err)
+	defer os.RemoveAll(dir)
+	is.NoErr(s.EnableContentCache(dir, 100))
+	var ranged []string
+	d.Handle("lfs/head_object", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("offset") != "" || q.Get("length") != "" {
+			ranged = append(ranged, r.URL.RawQuery)
+		}
+		d.Builtin(w, r)
+	})
+	r, err := s.GetObject("a", "b0", SetRange(2, 3))
+	is.NoErr(err)
+	data, err := ioutil.ReadAll(r)
+	is.NoErr(err)
+	is.Equal(string(data), "234")
+	r.Close()
+	is.Equal(countCalls(d, "lfs/head_object"), 1)
+	is.Equal(len(ranged), 0)
+}
+
+func TestObjectSizeJSON(t *testing.T) {
+	is := is.New(t)
+
+	var objs Objects
+	is.NoErr(json.Unmarshal([]byte(`{"Objects":[
+		{"ObjectName":"big","ObjectSize":5000000000},
+		{"ObjectName":"str","ObjectSize":"6000000000"},
+		{"ObjectName":"none"}
+	]}`), &objs))
+	is.Equal(objs.Objects[0].ObjectSize, int64(5000000000))
+	is.Equal(objs.Objects[1].ObjectSize, int64(6000000000))
+	is.Equal(objs.Objects[1].ObjectName, "str")
+	is.Equal(objs.Objects[2].ObjectSize, int64(0))
+	is.True(strings.Contains(objs.Objects[0].String(), "4.66GB"))
+
+	var ob ObjectStat
+	is.Err(json.Unmarshal([]byte(`{"ObjectSize":"lots"}`), &ob))
+}
@@ -0,0 +1,128 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Policy codes understood by the daemon, mirroring RsPolicy and MulPolicy in
+// go-mefs' data-format package.
+const (
+	PolicyErasureCode int32 = 1
+	PolicyReplication int32 = 2
+)
+
+// MaxStripeShards is the largest number of data plus parity shards a stripe
+// may be split into.
+const MaxStripeShards = 256
+
+var (
+	errInvalidDataCount   = errors.New("data count must be at least 1")
+	errInvalidParityCount = errors.New("parity count must be at least 1")
+	errTooManyShards      = fmt.Errorf("data and parity count must not exceed %d", MaxStripeShards)
+	errInvalidCopies      = errors.New("replication needs at least 2 copies")
+)
+
+// BucketPolicy describes how the objects of a bucket are spread across
+// providers. It is either an ErasureCode or a Replication.
+type BucketPolicy interface {
+	// Code returns the policy code sent to the daemon.
+	Code() int32
+	// Counts returns the data and parity counts sent to the daemon.
+	Counts() (dataCount, parityCount int)
+	// Validate reports whether the counts are acceptable.
+	Validate() error
+	String() string
+}
+
+// ErasureCode stores each stripe as Data shards plus Parity Reed-Solomon
+// shards; any Data of them are enough to rebuild the stripe.
+type ErasureCode struct {
+	Data   int
+	Parity int
+}
+
+func (ec ErasureCode) Code() int32 {
+	return PolicyErasureCode
+}
+
+func (ec ErasureCode) Counts() (int, int) {
+	return ec.Data, ec.Parity
+}
+
+func (ec ErasureCode) Validate() error {
+	switch {
+	case ec.Data < 1:
+		return errInvalidDataCount
+	case ec.Parity < 1:
+		return errInvalidParityCount
+	case ec.Data+ec.Parity > MaxStripeShards:
+		return errTooManyShards
+	}
+	return nil
+}
+
+func (ec ErasureCode) String() string {
+	return fmt.Sprintf("ErasureCode(%d+%d)", ec.Data, ec.Parity)
+}
+
+// Replication stores Copies full replicas of every stripe.
+type Replication struct {
+	Copies int
+}
+
+func (rp Replication) Code() int32 {
+	return PolicyReplication
+}
+
+// Counts follows the daemon's convention of describing replication as one
+// data shard plus Copies-1 parity shards.
+func (rp Replication) Counts() (int, int) {
+	return 1, rp.Copies - 1
+}
+
+func (rp Replication) Validate() error {
+	switch {
+	case rp.Copies < 2:
+		return errInvalidCopies
+	case rp.Copies > MaxStripeShards:
+		return errTooManyShards
+	}
+	return nil
+}
+
+func (rp Replication) String() string {
+	return fmt.Sprintf("Replication(%d)", rp.Copies)
+}
+
+// SetBucketPolicy sets the policy, data count and parity count of a new
+// bucket in one go, failing if the policy is invalid.
+func SetBucketPolicy(p BucketPolicy) LfsOpts {
+	return func(rb *RequestBuilder) error {
+		if p == nil {
+			return errors.New("nil bucket policy")
+		}
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		dataCount, parityCount := p.Counts()
+		rb.Option("policy", p.Code())
+		rb.Option("datacount", dataCount)
+		rb.Option("paritycount", parityCount)
+		return nil
+	}
+}
+
+// DecodePolicy converts the raw policy fields of a bucket back into a
+// BucketPolicy.
+func (bk BucketStat) DecodePolicy() (BucketPolicy, error) {
+	switch bk.Policy {
+	case PolicyErasureCode:
+		return ErasureCode{Data: int(bk.DataCount), Parity: int(bk.ParityCount)}, nil
+	case PolicyReplication:
+		// Every shard of a replicated stripe is a full copy.
+		return Replication{Copies: int(bk.DataCount + bk.ParityCount)}, nil
+	default:
+		return nil, fmt.Errorf("unknown bucket policy %d", bk.Policy)
+	}
+}
@@ -0,0 +1,58 @@
+package shell
+
+import (
+	"testing"
+
+	"github.com/cheekybits/is"
+)
+
+func TestBucketPolicyValidate(t *testing.T) {
+	is := is.New(t)
+
+	is.NoErr(ErasureCode{Data: 3, Parity: 2}.Validate())
+	is.Equal(ErasureCode{Data: 0, Parity: 2}.Validate(), errInvalidDataCount)
+	is.Equal(ErasureCode{Data: 3, Parity: 0}.Validate(), errInvalidParityCount)
+	is.Equal(ErasureCode{Data: 200, Parity: 100}.Validate(), errTooManyShards)
+
+	is.NoErr(Replication{Copies: 3}.Validate())
+	is.Equal(Replication{Copies: 1}.Validate(), errInvalidCopies)
+}
+
+func TestSetBucketPolicy(t *testing.T) {
+	is := is.New(t)
+
+	rb := &RequestBuilder{}
+	is.NoErr(SetBucketPolicy(ErasureCode{Data: 3, Parity: 2})(rb))
+	is.Equal(rb.opts, map[string]string{
+		"policy":      "1",
+		"datacount":   "3",
+		"paritycount": "2",
+	})
+
+	rb = &RequestBuilder{}
+	is.NoErr(SetBucketPolicy(Replication{Copies: 3})(rb))
+	is.Equal(rb.opts, map[string]string{
+		"policy":      "2",
+		"datacount":   "1",
+		"paritycount": "2",
+	})
+
+	rb = &RequestBuilder{}
+	is.Err(SetBucketPolicy(Replication{Copies: 0})(rb))
+	is.Equal(len(rb.opts), 0)
+}
+
+func TestDecodePolicy(t *testing.T) {
+	is := is.New(t)
+
+	p, err := BucketStat{Policy: 1, DataCount: 3, ParityCount: 2}.DecodePolicy()
+	is.NoErr(err)
+	is.Equal(p, ErasureCode{Data: 3, Parity: 2})
+
+	p, err = BucketStat{Policy: 2, DataCount: 1, ParityCount: 2}.DecodePolicy()
+	is.NoErr(err)
+	is.Equal(p, Replication{Copies: 3})
+
+	_, err = BucketStat{Policy: 7}.DecodePolicy()
+	is.Err(err)
+}
@@ -0,0 +1,106 @@
+package shell
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeLayouts are the formats the daemon has used for Ctime and similar
+// fields.
+var timeLayouts = []string{
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05 -0700 MST",
+	"2006-01-02 15:04:05",
+	time.RFC3339Nano,
+	time.RFC3339,
+}
+
+// parseTime parses a time as printed by the daemon. Plain integers are taken
+// as unix seconds.
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time format %q", s)
+}
+
+// Time is a point in time reported by the daemon. Raw keeps the text the
+// daemon sent; the embedded time.Time is zero if it could not be parsed.
+type Time struct {
+	time.Time
+	Raw string
+}
+
+// NewTime returns a Time for t, formatted the way the daemon formats times.
+func NewTime(t time.Time) Time {
+	return Time{Time: t, Raw: t.Format(timeLayouts[0])}
+}
+
+func (t Time) String() string {
+	if t.Raw != "" {
+		return t.Raw
+	}
+	if t.IsZero() {
+		return ""
+	}
+	return t.Time.Format(timeLayouts[0])
+}
+
+// UnmarshalJSON accepts a string in any of the daemon's formats or a number
+// of unix seconds. Values that cannot be parsed are kept in Raw rather than
+// failing the whole response.
+func (t *Time) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("null")) {
+		*t = Time{}
+		return nil
+	}
+	if len(b) > 0 && b[0] != '"' {
+		*t = rawTime(string(b))
+		return nil
+	}
+
+	var raw string
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*t = rawTime(raw)
+	return nil
+}
+
+func (t *Time) unmarshalCBOR(d *cborDecoder) error {
+	it, err := d.item()
+	if err != nil {
+		return err
+	}
+	raw, ok := cborText(it)
+	if !ok && it != nil {
+		raw = fmt.Sprint(it)
+	}
+	*t = rawTime(raw)
+	return nil
+}
+
+// rawTime returns the Time for the text the daemon sent.
+func rawTime(raw string) Time {
+	t := Time{Raw: raw}
+	if raw != "" {
+		t.Time, _ = parseTime(raw)
+	}
+	return t
+}
+
+// MarshalJSON writes the time back as the daemon sent it.
+func (t Time) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
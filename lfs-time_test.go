@@ -0,0 +1,92 @@
+package shell
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+)
+
+func TestParseTime(t *testing.T) {
+	is := is.New(t)
+
+	want := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+	for _, s := range []string{
+		"2019-03-04 05:06:07 UTC",
+		"2019-03-04T05:06:07Z",
+		"1551675967",
+	} {
+		got, err := parseTime(s)
+		is.NoErr(err)
+		is.True(got.Equal(want))
+	}
+
+	_, err := parseTime("yesterday")
+	is.Err(err)
+}
+
+func TestTimeJSON(t *testing.T) {
+	is := is.New(t)
+	want := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	var ob ObjectStat
+	is.NoErr(json.Unmarshal([]byte(`{"Ctime":"2019-03-04 05:06:07 UTC","LatestChalTime":1551675967}`), &ob))
+	is.True(ob.Ctime.Equal(want))
+	is.Equal(ob.Ctime.Raw, "2019-03-04 05:06:07 UTC")
+	is.True(ob.LatestChalTime.Equal(want))
+	is.Equal(ob.LatestChalTime.String(), "1551675967")
+
+	// unknown formats are kept rather than failing the response
+	var bk BucketStat
+	is.NoErr(json.Unmarshal([]byte(`{"Ctime":"last tuesday"}`), &bk))
+	is.True(bk.Ctime.IsZero())
+	is.Equal(bk.Ctime.String(), "last tuesday")
+	is.NoErr(json.Unmarshal([]byte(`{"LatestChalTime":1551675967.5}`), &ob))
+	is.True(ob.LatestChalTime.IsZero())
+	is.Equal(ob.LatestChalTime.Raw, "1551675967.5")
+
+	buf, err := json.Marshal(bk)
+	is.NoErr(err)
+	is.NoErr(json.Unmarshal(buf, &bk))
+	is.Equal(bk.Ctime.Raw, "last tuesday")
+}
+
+func TestListObjectsSortAndFilter(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	now := time.Now().Truncate(time.Second)
+	d.Put("b0", "a", []byte("aaaa"), now.Add(-3*time.Hour))
+	d.Put("b0", "b", []byte("b"), now.Add(-1*time.Hour))
+	d.Put("b0", "c", []byte("cc"), now.Add(-2*time.Hour))
+
+	names := func(objs *Objects) []string {
+		var ns []string
+		for _, ob := range objs.Objects {
+			ns = append(ns, ob.ObjectName)
+		}
+		return ns
+	}
+
+	objs, err := s.ListObjects("b0", SortObjects(OrderByCtime, false))
+	is.NoErr(err)
+	is.Equal(names(objs), []string{"a", "c", "b"})
+
+	objs, err = s.ListObjects("b0", SortObjects(OrderBySize, true))
+	is.NoErr(err)
+	is.Equal(names(objs), []string{"a", "c", "b"})
+
+	objs, err = s.ListObjects("b0", CreatedBetween(now.Add(-150*time.Minute), time.Time{}), SortObjects(OrderByName, false))
+	is.NoErr(err)
+	is.Equal(names(objs), []string{"b", "c"})
+
+	objs, err = s.ListObjects("b0", SizeBetween(2, 0))
+	is.NoErr(err)
+	is.Equal(names(objs), []string{"a", "c"})
+
+	_, err = s.ListObjects("b0", SizeBetween(5, 1))
+	is.Err(err)
+}
@@ -0,0 +1,580 @@
+package shell
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TransferKind tells which way a transfer job moves data.
+type TransferKind string
+
+const (
+	TransferUpload   TransferKind = "upload"
+	TransferDownload TransferKind = "download"
+)
+
+// TransferState is where a transfer job is in its life.
+type TransferState string
+
+const (
+	JobQueued  TransferState = "queued"
+	JobRunning TransferState = "running"
+	JobDone    TransferState = "done"
+	JobFailed  TransferState = "failed"
+)
+
+// TransferJob uploads the file at LocalPath to an object, or downloads an
+// object to LocalPath, for the user at Address. An empty Address uses the
+// daemon's default user.
+type TransferJob struct {
+	ID        string
+	Kind      TransferKind
+	Address   string
+	Bucket    string
+	Object    string
+	LocalPath string
+
+	State    TransferState
+	Attempts int
+	// Err is the error of the last failed attempt.
+	Err   string
+	Bytes int64
+
+	Created  time.Time
+	Started  time.Time
+	Finished time.Time
+	// NotBefore delays a retry.
+	NotBefore time.Time
+}
+
+func (j *TransferJob) validate() error {
+	switch {
+	case j.Kind != TransferUpload && j.Kind != TransferDownload:
+		return fmt.Errorf("unknown transfer kind %q", j.Kind)
+	case j.Bucket == "" || j.Object == "":
+		return errors.New("transfer job needs a bucket and an object")
+	case j.LocalPath == "":
+		return errors.New("transfer job needs a local path")
+	}
+	return nil
+}
+
+// TransferConfig configures a TransferManager. Zero fields take the
+// defaults.
+type TransferConfig struct {
+	// Parallelism is the number of jobs run at once, 4 by default.
+	Parallelism int
+	// UserParallelism is the number of jobs run at once for one user, 2
+	// by default.
+	UserParallelism int
+	// MaxRetries is how many times a failed job is tried again, 3 by
+	// default. Set it negative to never retry. Jobs whose object does not
+	// exist or whose local file can not be used fail at once. An upload
+	// tried again is done without sending the file if the object is
+	// already stored with the same MD5.
+	MaxRetries int
+	// RetryDelay is the wait before the first retry, 1s by default. It
+	// doubles with every further attempt.
+	RetryDelay time.Duration
+	// StatePath, if set, is the file the queue is kept in so that a new
+	// manager resumes the jobs of a previous one.
+	StatePath string
+}
+
+// TransferStats sums up the jobs of a TransferManager.
+type TransferStats struct {
+	Queued  int
+	Running int
+	Done    int
+	Failed  int
+	// Bytes is the amount of data moved by done jobs.
+	Bytes int64
+	// Busy is the time during which at least one job was running.
+	Busy time.Duration
+}
+
+// Throughput returns the bytes per second moved while the manager was busy.
+func (st TransferStats) Throughput() float64 {
+	if st.Busy <= 0 {
+		return 0
+	}
+	return float64(st.Bytes) / st.Busy.Seconds()
+}
+
+// TransferManager runs upload and download jobs in the background.
+type TransferManager struct {
+	shell   *Shell
+	cfg     TransferConfig
+	options []LfsOpts
+
+	// OnFinish, if set, is called when a job is done or has failed for
+	// good.
+	OnFinish func(TransferJob)
+
+	mu         sync.Mutex
+	jobs       []*TransferJob
+	byID       map[string]*TransferJob
+	nextID     int
+	running    int
+	perUser    map[string]int
+	busy       time.Duration
+	busySince  time.Time
+	kick       chan struct{}
+	idle       chan struct{}
+	persistErr error
+}
+
+type transferState struct {
+	NextID int
+	Jobs   []*TransferJob
+}
+
+// NewTransferManager returns a manager for cfg, resuming the jobs kept in
+// cfg.StatePath, if any. The options are passed on to every request.
+func (s *Shell) NewTransferManager(cfg TransferConfig, options ...LfsOpts) (*TransferManager, error) {
+	if cfg.Parallelism <= 0 {
+		cfg.Parallelism = 4
+	}
+	if cfg.UserParallelism <= 0 {
+		cfg.UserParallelism = 2
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = time.Second
+	}
+
+	m := &TransferManager{
+		shell:   s,
+		cfg:     cfg,
+		options: options,
+		byID:    make(map[string]*TransferJob),
+		perUser: make(map[string]int),
+		kick:    make(chan struct{}, 1),
+	}
+	if cfg.StatePath == "" {
+		return m, nil
+	}
+
+	buf, err := ioutil.ReadFile(cfg.StatePath)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var st transferState
+	if err := json.Unmarshal(buf, &st); err != nil {
+		return nil, fmt.Errorf("invalid transfer state %s: %s", cfg.StatePath, err)
+	}
+	m.nextID = st.NextID
+	for _, j := range st.Jobs {
+		// jobs cut short by a restart start over
+		if j.State == JobRunning {
+			j.State = JobQueued
+		}
+		m.jobs = append(m.jobs, j)
+		m.byID[j.ID] = j
+	}
+	return m, nil
+}
+
+// Upload queues the upload of the file at localPath and returns the job ID.
+func (m *TransferManager) Upload(address, bucket, object, localPath string) (string, error) {
+	return m.Submit(TransferJob{
+		Kind:      TransferUpload,
+		Address:   address,
+		Bucket:    bucket,
+		Object:    object,
+		LocalPath: localPath,
+	})
+}
+
+// Download queues the download of an object to localPath and returns the
+// job ID.
+func (m *TransferManager) Download(address, bucket, object, localPath string) (string, error) {
+	return m.Submit(TransferJob{
+		Kind:      TransferDownload,
+		Address:   address,
+		Bucket:    bucket,
+		Object:    object,
+		LocalPath: localPath,
+	})
+}
+
+// Submit queues a job and returns its ID. Only the fields describing the
+// transfer are used.
+func (m *TransferManager) Submit(job TransferJob) (string, error) {
+	if err := job.validate(); err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	m.nextID++
+	j := &TransferJob{
+		ID:        "job-" + strconv.Itoa(m.nextID),
+		Kind:      job.Kind,
+		Address:   job.Address,
+		Bucket:    job.Bucket,
+		Object:    job.Object,
+		LocalPath: job.LocalPath,
+		State:     JobQueued,
+		Created:   time.Now(),
+	}
+	m.jobs = append(m.jobs, j)
+	m.byID[j.ID] = j
+	m.persistLocked()
+	m.mu.Unlock()
+
+	m.wake()
+	return j.ID, nil
+}
+
+// Job returns a copy of the job with the given ID.
+func (m *TransferManager) Job(id string) (TransferJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.byID[id]
+	if !ok {
+		return TransferJob{}, false
+	}
+	return *j, true
+}
+
+// Jobs returns a copy of every job, in the order they were submitted.
+func (m *TransferManager) Jobs() []TransferJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := make([]TransferJob, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, *j)
+	}
+	return jobs
+}
+
+// Prune forgets the jobs that are done or have failed and returns how many
+// there were.
+func (m *TransferManager) Prune() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.jobs[:0]
+	n := 0
+	for _, j := range m.jobs {
+		if j.State == JobDone || j.State == JobFailed {
+			delete(m.byID, j.ID)
+			n++
+			continue
+		}
+		kept = append(kept, j)
+	}
+	m.jobs = kept
+	m.persistLocked()
+	return n
+}
+
+// Stats sums up the jobs.
+func (m *TransferManager) Stats() TransferStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := TransferStats{Busy: m.busy}
+	if m.running > 0 {
+		st.Busy += time.Since(m.busySince)
+	}
+	for _, j := range m.jobs {
+		switch j.State {
+		case JobQueued:
+			st.Queued++
+		case JobRunning:
+			st.Running++
+		case JobDone:
+			st.Done++
+			st.Bytes += j.Bytes
+		case JobFailed:
+			st.Failed++
+		}
+	}
+	return st
+}
+
+// Err returns the last error met while saving the queue to StatePath. The
+// manager keeps working from memory when it can not save it.
+func (m *TransferManager) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.persistErr
+}
+
+// Wait blocks until no job is queued or running, or ctx is done.
+func (m *TransferManager) Wait(ctx context.Context) error {
+	for {
+		m.mu.Lock()
+		if m.pendingLocked() == 0 {
+			m.mu.Unlock()
+			return nil
+		}
+		if m.idle == nil {
+			m.idle = make(chan struct{})
+		}
+		idle := m.idle
+		m.mu.Unlock()
+
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Run starts queued jobs as the parallelism allows until ctx is done, then
+// waits for the running jobs to end.
+func (m *TransferManager) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		next := m.startJobs(&wg)
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if !next.IsZero() {
+			timer.Reset(time.Until(next))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-m.kick:
+		case <-timer.C:
+		}
+	}
+}
+
+// startJobs starts what queued jobs it can and returns when the earliest
+// delayed retry is due, if any.
+func (m *TransferManager) startJobs(wg *sync.WaitGroup) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var next time.Time
+	started := false
+	for _, j := range m.jobs {
+		if m.running >= m.cfg.Parallelism {
+			break
+		}
+		if j.State != JobQueued || m.perUser[j.Address] >= m.cfg.UserParallelism {
+			continue
+		}
+		if j.NotBefore.After(now) {
+			if next.IsZero() || j.NotBefore.Before(next) {
+				next = j.NotBefore
+			}
+			continue
+		}
+
+		if m.running == 0 {
+			m.busySince = now
+		}
+		m.running++
+		m.perUser[j.Address]++
+		j.State = JobRunning
+		j.Attempts++
+		j.Started = now
+		started = true
+		wg.Add(1)
+		go func(j TransferJob) {
+			defer wg.Done()
+			n, err := m.transfer(&j)
+			m.finish(j.ID, n, err)
+		}(*j)
+	}
+	if started {
+		m.persistLocked()
+	}
+	return next
+}
+
+func (m *TransferManager) finish(id string, n int64, err error) {
+	m.mu.Lock()
+	j := m.byID[id]
+	now := time.Now()
+	m.running--
+	if m.running == 0 {
+		m.busy += now.Sub(m.busySince)
+	}
+	if m.perUser[j.Address]--; m.perUser[j.Address] == 0 {
+		delete(m.perUser, j.Address)
+	}
+
+	var finished *TransferJob
+	switch {
+	case err == nil:
+		j.State = JobDone
+		j.Err = ""
+		j.Bytes = n
+		j.Finished = now
+		finished = j
+	case m.cfg.MaxRetries >= 0 && j.Attempts <= m.cfg.MaxRetries && !permanentTransferError(err):
+		j.State = JobQueued
+		j.Err = err.Error()
+		j.NotBefore = now.Add(m.cfg.RetryDelay << uint(j.Attempts-1))
+	default:
+		j.State = JobFailed
+		j.Err = err.Error()
+		j.Finished = now
+		finished = j
+	}
+	m.persistLocked()
+	if m.pendingLocked() == 0 && m.idle != nil {
+		close(m.idle)
+		m.idle = nil
+	}
+	var done TransferJob
+	if finished != nil {
+		done = *finished
+	}
+	onFinish := m.OnFinish
+	m.mu.Unlock()
+
+	if finished != nil && onFinish != nil {
+		onFinish(done)
+	}
+	m.wake()
+}
+
+func (m *TransferManager) transfer(j *TransferJob) (int64, error) {
+	options := m.options
+	if j.Address != "" {
+		options = append(options[:len(options):len(options)], SetAddress(j.Address))
+	}
+
+	switch j.Kind {
+	case TransferUpload:
+		f, err := os.Open(j.LocalPath)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		st, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		// a retry, or a job cut short by a restart, may follow an upload
+		// whose answer was lost; the daemon would refuse it again
+		if j.Attempts > 1 {
+			stored, err := m.uploaded(f, j, options)
+			if err != nil {
+				return 0, err
+			}
+			if stored {
+				return st.Size(), nil
+			}
+		}
+		if _, err := m.shell.PutObject(f, j.Object, j.Bucket, options...); err != nil {
+			return 0, err
+		}
+		return st.Size(), nil
+	default:
+		// GetObjectToFile refuses to overwrite, say so in a way finish
+		// knows not to retry
+		target := j.LocalPath
+		if st, err := os.Stat(target); err == nil && st.IsDir() {
+			target = filepath.Join(target, j.Object)
+		}
+		if _, err := os.Lstat(target); err == nil {
+			return 0, &os.PathError{Op: "download", Path: target, Err: os.ErrExist}
+		}
+		if err := m.shell.GetObjectToFile(j.Object, j.Bucket, j.LocalPath, options...); err != nil {
+			return 0, err
+		}
+		st, err := os.Stat(target)
+		if err != nil {
+			return 0, err
+		}
+		return st.Size(), nil
+	}
+}
+
+// uploaded tells whether the object of an upload job is already stored with
+// the content of f, and rewinds f.
+func (m *TransferManager) uploaded(f *os.File, j *TransferJob, options []LfsOpts) (bool, error) {
+	objs, err := m.shell.headObject(j.Object, j.Bucket, options...)
+	if err != nil || len(objs.Objects) == 0 || objs.Objects[0].MD5 == "" {
+		// not there, or not comparable: upload as usual
+		return false, nil
+	}
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	return strings.EqualFold(hex.EncodeToString(h.Sum(nil)), objs.Objects[0].MD5), nil
+}
+
+// permanentTransferError tells whether trying a job again can not help: the
+// object is not there, or the local file can not be read or written.
+func permanentTransferError(err error) bool {
+	switch e := err.(type) {
+	case *Error:
+		return strings.Contains(e.Message, "not exist")
+	case *os.PathError, *os.LinkError, *os.SyscallError:
+		return true
+	}
+	return false
+}
+
+func (m *TransferManager) pendingLocked() int {
+	n := 0
+	for _, j := range m.jobs {
+		if j.State == JobQueued || j.State == JobRunning {
+			n++
+		}
+	}
+	return n
+}
+
+func (m *TransferManager) wake() {
+	select {
+	case m.kick <- struct{}{}:
+	default:
+	}
+}
+
+// persistLocked writes the queue to StatePath, through a temporary file so
+// that a crash never leaves a torn state behind.
+func (m *TransferManager) persistLocked() {
+	if m.cfg.StatePath == "" {
+		return
+	}
+	buf, err := json.MarshalIndent(transferState{NextID: m.nextID, Jobs: m.jobs}, "", "  ")
+	if err == nil {
+		tmp := m.cfg.StatePath + ".tmp"
+		if err = ioutil.WriteFile(tmp, buf, 0600); err == nil {
+			err = os.Rename(tmp, m.cfg.StatePath)
+		}
+	}
+	if err != nil {
+		m.persistErr = fmt.Errorf("saving transfer state: %s", err)
+	}
+}
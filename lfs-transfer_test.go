@@ -0,0 +1,204 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+	"github.com/xcshuan/go-mefs-api/internal/fakedaemon"
+)
+
+func TestTransferManager(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+	dir, err := ioutil.TempDir("", "mefs-transfer")
+	is.NoErr(err)
+	defer os.RemoveAll(dir)
+
+	_, err = s.CreateBucket("b0")
+	is.NoErr(err)
+
+	var mu sync.Mutex
+	inflight, maxInflight := 0, 0
+	perUser, maxPerUser := map[string]int{}, 0
+	d.Handle("lfs/put_object", func(w http.ResponseWriter, r *http.Request) {
+		addr := r.URL.Query().Get("address")
+		mu.Lock()
+		inflight++
+		perUser[addr]++
+		if inflight > maxInflight {
+			maxInflight = inflight
+		}
+		if perUser[addr] > maxPerUser {
+			maxPerUser = perUser[addr]
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		d.Builtin(w, r)
+		mu.Lock()
+		inflight--
+		perUser[addr]--
+		mu.Unlock()
+	})
+
+	m, err := s.NewTransferManager(TransferConfig{Parallelism: 3, UserParallelism: 2, RetryDelay: time.Millisecond})
+	is.NoErr(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+
+	var ids []string
+	for i := 0; i < 8; i++ {
+		name := "o" + strconv.Itoa(i)
+		p := filepath.Join(dir, name)
+		is.NoErr(ioutil.WriteFile(p, bytes.Repeat([]byte("x"), 100), 0600))
+		id, err := m.Upload("user"+strconv.Itoa(i%2), "b0", name, p)
+		is.NoErr(err)
+		ids = append(ids, id)
+	}
+	is.NoErr(m.Wait(ctx))
+
+	mu.Lock()
+	is.True(maxInflight <= 3)
+	is.True(maxPerUser <= 2)
+	is.True(maxInflight > 1)
+	mu.Unlock()
+
+	st := m.Stats()
+	is.Equal(st.Done, 8)
+	is.Equal(st.Bytes, int64(800))
+	is.True(st.Throughput() > 0)
+	for _, id := range ids {
+		job, ok := m.Job(id)
+		is.True(ok)
+		is.Equal(job.State, JobDone)
+	}
+
+	// downloads, one of which fails for a while and one for good
+	gets := 0
+	d.Handle("lfs/get_object", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query()["arg"][1] == "o1" {
+			mu.Lock()
+			gets++
+			n := gets
+			mu.Unlock()
+			if n <= 2 {
+				fakedaemon.Error(w, "daemon busy")
+				return
+			}
+		}
+		d.Builtin(w, r)
+	})
+	id, err := m.Download("user0", "b0", "o0", filepath.Join(dir, "copy"))
+	is.NoErr(err)
+	flaky, err := m.Download("user1", "b0", "o1", filepath.Join(dir, "flaky"))
+	is.NoErr(err)
+	missing, err := m.Download("user0", "b0", "missing", filepath.Join(dir, "missing"))
+	is.NoErr(err)
+	noFile, err := m.Upload("user1", "b0", "nofile", filepath.Join(dir, "nofile"))
+	is.NoErr(err)
+	is.NoErr(m.Wait(ctx))
+
+	job, _ := m.Job(id)
+	is.Equal(job.State, JobDone)
+	got, err := ioutil.ReadFile(filepath.Join(dir, "copy"))
+	is.NoErr(err)
+	is.Equal(len(got), 100)
+
+	job, _ = m.Job(flaky)
+	is.Equal(job.State, JobDone)
+	is.Equal(job.Attempts, 3)
+
+	// retrying can not make a missing object or file appear
+	job, _ = m.Job(missing)
+	is.Equal(job.State, JobFailed)
+	is.Equal(job.Attempts, 1)
+	is.Equal(job.Err, "object not exist")
+	job, _ = m.Job(noFile)
+	is.Equal(job.State, JobFailed)
+	is.Equal(job.Attempts, 1)
+
+	is.Equal(m.Prune(), 12)
+	is.Equal(len(m.Jobs()), 0)
+
+	_, err = m.Upload("", "", "o", "p")
+	is.Err(err)
+}
+
+func TestTransferManagerResume(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+	dir, err := ioutil.TempDir("", "mefs-transfer")
+	is.NoErr(err)
+	defer os.RemoveAll(dir)
+
+	_, err = s.CreateBucket("b0")
+	is.NoErr(err)
+	p := filepath.Join(dir, "data")
+	is.NoErr(ioutil.WriteFile(p, []byte("data"), 0600))
+	state := filepath.Join(dir, "queue.json")
+
+	// queue jobs but never run them, as if the process died
+	m, err := s.NewTransferManager(TransferConfig{StatePath: state})
+	is.NoErr(err)
+	first, err := m.Upload("", "b0", "a", p)
+	is.NoErr(err)
+	second, err := m.Upload("", "b0", "b", p)
+	is.NoErr(err)
+	// the upload of b was under way and reached the daemon, but the
+	// process died before hearing back
+	m.mu.Lock()
+	m.byID[second].State = JobRunning
+	m.byID[second].Attempts++
+	m.persistLocked()
+	m.mu.Unlock()
+	d.Put("b0", "b", []byte("data"), time.Now())
+	is.NoErr(m.Err())
+
+	m, err = s.NewTransferManager(TransferConfig{StatePath: state})
+	is.NoErr(err)
+	is.Equal(m.Stats().Queued, 2)
+	third, err := m.Upload("", "b0", "c", p)
+	is.NoErr(err)
+	is.True(third != first)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go m.Run(ctx)
+	is.NoErr(m.Wait(ctx))
+
+	cancel()
+	// b was found stored instead of being refused as a duplicate
+	is.Equal(countCalls(d, "lfs/put_object"), 2)
+	b, ok := m.Job(second)
+	is.True(ok)
+	is.Equal(b.State, JobDone)
+
+	// nothing changes, so starting jobs writes nothing
+	is.NoErr(os.Rename(state, state+".bak"))
+	var wg sync.WaitGroup
+	m.startJobs(&wg)
+	wg.Wait()
+	_, err = os.Stat(state)
+	is.True(os.IsNotExist(err))
+	is.NoErr(os.Rename(state+".bak", state))
+
+	for _, name := range []string{"a", "b", "c"} {
+		_, ok := d.Object("b0", name)
+		is.True(ok)
+	}
+	m, err = s.NewTransferManager(TransferConfig{StatePath: state})
+	is.NoErr(err)
+	is.Equal(m.Stats().Done, 3)
+}
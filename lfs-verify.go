@@ -0,0 +1,109 @@
+package shell
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+func checkHexSum(sum string, size int) error {
+	b, err := hex.DecodeString(sum)
+	if err != nil {
+		return err
+	}
+	if len(b) != size {
+		return fmt.Errorf("checksum %q has %d bytes, want %d", sum, len(b), size)
+	}
+	return nil
+}
+
+// verifySums checks computed checksums against wanted ones; an empty want
+// is not checked.
+func verifySums(md5Sum, sha256Sum, wantMD5, wantSHA256 string) error {
+	if wantMD5 != "" && !strings.EqualFold(md5Sum, wantMD5) {
+		return ErrMD5Mismatch
+	}
+	if wantSHA256 != "" && !strings.EqualFold(sha256Sum, wantSHA256) {
+		return ErrSHA256Mismatch
+	}
+	return nil
+}
+
+// hashReader computes the MD5 and SHA-256 of what is read through it and
+// remembers the first error other than io.EOF its source returned.
+type hashReader struct {
+	r      io.Reader
+	md5    hash.Hash
+	sha256 hash.Hash
+	err    error
+}
+
+func newHashReader(r io.Reader) *hashReader {
+	return &hashReader{
+		r:      r,
+		md5:    md5.New(),
+		sha256: sha256.New(),
+	}
+}
+
+func (hr *hashReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.md5.Write(p[:n])
+	hr.sha256.Write(p[:n])
+	if err != nil && err != io.EOF && hr.err == nil {
+		hr.err = err
+	}
+	return n, err
+}
+
+func (hr *hashReader) MD5() string {
+	return hex.EncodeToString(hr.md5.Sum(nil))
+}
+
+func (hr *hashReader) SHA256() string {
+	return hex.EncodeToString(hr.sha256.Sum(nil))
+}
+
+// verifyingReader checks the checksums of a download when it reaches EOF,
+// returning ErrMD5Mismatch or ErrSHA256Mismatch instead of io.EOF if the
+// data does not match.
+type verifyingReader struct {
+	hr         *hashReader
+	rc         io.ReadCloser
+	wantMD5    string
+	wantSHA256 string
+	err        error
+}
+
+func newVerifyingReader(rc io.ReadCloser, wantMD5, wantSHA256 string) *verifyingReader {
+	return &verifyingReader{
+		hr:         newHashReader(rc),
+		rc:         rc,
+		wantMD5:    wantMD5,
+		wantSHA256: wantSHA256,
+	}
+}
+
+func (vr *verifyingReader) Read(p []byte) (int, error) {
+	if vr.err != nil {
+		return 0, vr.err
+	}
+	n, err := vr.hr.Read(p)
+	if err == io.EOF {
+		if verr := verifySums(vr.hr.MD5(), vr.hr.SHA256(), vr.wantMD5, vr.wantSHA256); verr != nil {
+			err = verr
+		}
+	}
+	if err != nil {
+		vr.err = err
+	}
+	return n, err
+}
+
+func (vr *verifyingReader) Close() error {
+	return vr.rc.Close()
+}
@@ -3,8 +3,15 @@ package shell
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math/big"
+	"mime"
 	"strconv"
+	"time"
 )
 
 type UserPrivMessage struct {
@@ -26,13 +33,13 @@ func (fl StringList) String() string {
 }
 
 type IntList struct {
-	ChildLists []int
+	ChildLists []int64
 }
 
 func (fl IntList) String() string {
 	var buffer bytes.Buffer
 	for i := 0; i < len(fl.ChildLists); i++ {
-		buffer.WriteString(strconv.Itoa(fl.ChildLists[i]))
+		buffer.WriteString(strconv.FormatInt(fl.ChildLists[i], 10))
 		buffer.WriteString("\n")
 	}
 	return buffer.String()
@@ -40,6 +47,50 @@ func (fl IntList) String() string {
 
 type LfsOpts = func(*RequestBuilder) error
 
+// lfsOptions are the settings of LfsOpts that only concern the client.
+type lfsOptions struct {
+	skipVerify   bool
+	expectMD5    string
+	expectSHA256 string
+
+	ranged      bool
+	rangeOffset int64
+	rangeLength int64
+
+	concurrency int
+	recursive   bool
+
+	order         ObjectOrder
+	descending    bool
+	createdAfter  time.Time
+	createdBefore time.Time
+	minSize       int64
+	maxSize       int64
+}
+
+// localOptions collects the client-side settings of options without
+// building a request.
+func localOptions(options []LfsOpts) (lfsOptions, error) {
+	var rb RequestBuilder
+	for _, option := range options {
+		if err := option(&rb); err != nil {
+			return lfsOptions{}, err
+		}
+	}
+	return rb.lfs, nil
+}
+
+// ObjectOrder is the order ListObjects returns objects in.
+type ObjectOrder int
+
+const (
+	// OrderByDaemon keeps the order the daemon listed the objects in.
+	OrderByDaemon ObjectOrder = iota
+	OrderByName
+	OrderByCtime
+	OrderBySize
+)
+
 func SetAddress(addr string) LfsOpts {
 	return func(rb *RequestBuilder) error {
 		rb.Option("address", addr)
@@ -54,6 +105,108 @@ func SetObjectName(objectName string) LfsOpts {
 	}
 }
 
+// SetContentType sets the MIME type stored with a new object.
+func SetContentType(contentType string) LfsOpts {
+	return func(rb *RequestBuilder) error {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return err
+		}
+		rb.Option("contenttype", contentType)
+		return nil
+	}
+}
+
+// SetMetadata sets user-defined key/value pairs stored with a new object.
+func SetMetadata(meta map[string]string) LfsOpts {
+	return func(rb *RequestBuilder) error {
+		for k := range meta {
+			if k == "" {
+				return errors.New("empty metadata key")
+			}
+		}
+		buf, err := json.Marshal(meta)
+		if err != nil {
+			return err
+		}
+		rb.Option("metadata", buf)
+		return nil
+	}
+}
+
+// VerifyChecksums controls whether PutObject and GetObject check the data
+// they transfer against the daemon's checksums. It is enabled by default.
+func VerifyChecksums(enabled bool) LfsOpts {
+	return func(rb *RequestBuilder) error {
+		rb.lfs.skipVerify = !enabled
+		return nil
+	}
+}
+
+// ExpectMD5 makes PutObject and GetObject fail unless the data transferred
+// has the given hex encoded MD5.
+func ExpectMD5(sum string) LfsOpts {
+	return func(rb *RequestBuilder) error {
+		if err := checkHexSum(sum, md5.Size); err != nil {
+			return err
+		}
+		rb.lfs.expectMD5 = sum
+		return nil
+	}
+}
+
+// ExpectSHA256 makes PutObject and GetObject fail unless the data
+// transferred has the given hex encoded SHA-256.
+func ExpectSHA256(sum string) LfsOpts {
+	return func(rb *RequestBuilder) error {
+		if err := checkHexSum(sum, sha256.Size); err != nil {
+			return err
+		}
+		rb.lfs.expectSHA256 = sum
+		return nil
+	}
+}
+
+// SetRange makes GetObject return length bytes of the object from offset
+// on, or all of them from offset on if length is zero. Checksums cover
+// whole objects, so a range is not verified.
+func SetRange(offset, length int64) LfsOpts {
+	return func(rb *RequestBuilder) error {
+		if offset < 0 || length < 0 {
+			return fmt.Errorf("invalid range of %d bytes at %d", length, offset)
+		}
+		rb.lfs.ranged = true
+		rb.lfs.rangeOffset = offset
+		rb.lfs.rangeLength = length
+		rb.Option("offset", offset)
+		if length > 0 {
+			rb.Option("length", length)
+		}
+		return nil
+	}
+}
+
+// SetConcurrency sets how many deletions DeleteObjects, DeletePrefix and a
+// Recursive DeleteBucket run at once.
+func SetConcurrency(n int) LfsOpts {
+	return func(rb *RequestBuilder) error {
+		if n < 1 {
+			return fmt.Errorf("invalid concurrency %d", n)
+		}
+		rb.lfs.concurrency = n
+		return nil
+	}
+}
+
+// Recursive makes DeleteBucket delete the objects of the bucket first,
+// including the ones the client keeps for itself. The bucket is left in
+// place if any of them could not be deleted.
+func Recursive(enabled bool) LfsOpts {
+	return func(rb *RequestBuilder) error {
+		rb.lfs.recursive = enabled
+		return nil
+	}
+}
+
 func SetPrefixFilter(prefix string) LfsOpts {
 	return func(rb *RequestBuilder) error {
 		rb.Option("prefix", prefix)
@@ -61,6 +214,47 @@ func SetPrefixFilter(prefix string) LfsOpts {
 	}
 }
 
+// SortObjects makes ListObjects sort its result.
+func SortObjects(order ObjectOrder, descending bool) LfsOpts {
+	return func(rb *RequestBuilder) error {
+		if order < OrderByDaemon || order > OrderBySize {
+			return fmt.Errorf("unknown object order %d", order)
+		}
+		rb.lfs.order = order
+		rb.lfs.descending = descending
+		return nil
+	}
+}
+
+// CreatedBetween makes ListObjects return only objects created in
+// [after, before). A zero time leaves that end open.
+func CreatedBetween(after, before time.Time) LfsOpts {
+	return func(rb *RequestBuilder) error {
+		if !after.IsZero() && !before.IsZero() && !after.Before(before) {
+			return errors.New("empty creation time range")
+		}
+		rb.lfs.createdAfter = after
+		rb.lfs.createdBefore = before
+		return nil
+	}
+}
+
+// SizeBetween makes ListObjects return only objects of min to max bytes,
+// inclusive. A max of 0 means no upper bound.
+func SizeBetween(min, max int64) LfsOpts {
+	return func(rb *RequestBuilder) error {
+		if min < 0 || max < 0 || (max > 0 && min > max) {
+			return fmt.Errorf("invalid size range [%d, %d]", min, max)
+		}
+		rb.lfs.minSize = min
+		rb.lfs.maxSize = max
+		return nil
+	}
+}
+
+// SetPolicy sets the raw policy code of a new bucket.
+//
+// Deprecated: use SetBucketPolicy, which also sets and validates the counts.
 func SetPolicy(policy int) LfsOpts {
 	return func(rb *RequestBuilder) error {
 		rb.Option("policy", policy)
@@ -109,9 +303,17 @@ func ForceFlush(enabled bool) LfsOpts {
 	}
 }
 
+// UseErasureCodeOrMulRep selects erasure coding when enabled and
+// multi-replication otherwise.
+//
+// Deprecated: use SetBucketPolicy.
 func UseErasureCodeOrMulRep(enabled bool) LfsOpts {
 	return func(rb *RequestBuilder) error {
-		rb.Option("policy", enabled)
+		if enabled {
+			rb.Option("policy", PolicyErasureCode)
+		} else {
+			rb.Option("policy", PolicyReplication)
+		}
 		return nil
 	}
 }
@@ -120,7 +322,9 @@ func (s *Shell) CreateUser(options ...LfsOpts) (*UserPrivMessage, error) {
 	var user UserPrivMessage
 	rb := s.Request("create")
 	for _, option := range options {
-		option(rb)
+		if err := option(rb); err != nil {
+			return nil, err
+		}
 	}
 
 	if err := rb.Exec(context.Background(), &user); err != nil {
@@ -133,7 +337,9 @@ func (s *Shell) StartUser(address string, options ...LfsOpts) error {
 	var res StringList
 	rb := s.Request("lfs/start", address)
 	for _, option := range options {
-		option(rb)
+		if err := option(rb); err != nil {
+			return err
+		}
 	}
 	if err := rb.Exec(context.Background(), &res); err != nil {
 		return err
@@ -145,7 +351,9 @@ func (s *Shell) Fsync(options ...LfsOpts) error {
 	var res StringList
 	rb := s.Request("lfs/fsync")
 	for _, option := range options {
-		option(rb)
+		if err := option(rb); err != nil {
+			return err
+		}
 	}
 
 	if err := rb.Exec(context.Background(), &res); err != nil {
@@ -158,7 +366,9 @@ func (s *Shell) ShowStorage(options ...LfsOpts) error {
 	var res string
 	rb := s.Request("lfs/show_storage")
 	for _, option := range options {
-		option(rb)
+		if err := option(rb); err != nil {
+			return err
+		}
 	}
 
 	if err := rb.Exec(context.Background(), &res); err != nil {
@@ -171,7 +381,9 @@ func (s *Shell) ShowBalance(options ...LfsOpts) (*big.Int, error) {
 	var res *big.Int
 	rb := s.Request("lfs/show_balance")
 	for _, option := range options {
-		option(rb)
+		if err := option(rb); err != nil {
+			return big.NewInt(0), err
+		}
 	}
 
 	if err := rb.Exec(context.Background(), &res); err != nil {
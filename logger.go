@@ -3,39 +3,338 @@ package shell
 import (
 	"context"
 	"encoding/json"
-	"io"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
 )
 
-// Logger is used to handle incoming logs from the ipfs node
+// Log levels in increasing order of severity.
+const (
+	LevelDebug   = "debug"
+	LevelInfo    = "info"
+	LevelWarning = "warning"
+	LevelError   = "error"
+	LevelFatal   = "fatal"
+)
+
+var levelRanks = map[string]int{
+	"debug":    0,
+	"info":     1,
+	"notice":   1,
+	"warn":     2,
+	"warning":  2,
+	"error":    3,
+	"critical": 4,
+	"dpanic":   4,
+	"panic":    4,
+	"fatal":    4,
+}
+
+var errLoggerClosed = errors.New("logger closed")
+
+// LogEvent is one event of the daemon's log.
+type LogEvent struct {
+	Time   time.Time
+	Level  string
+	System string
+	Event  string
+	// Fields holds everything else the event carried.
+	Fields map[string]interface{}
+}
+
+func (ev LogEvent) String() string {
+	return fmt.Sprintf("%s %s %s: %s %v", ev.Time.Format(time.RFC3339), ev.Level, ev.System, ev.Event, ev.Fields)
+}
+
+func newLogEvent(raw map[string]interface{}) *LogEvent {
+	ev := &LogEvent{Fields: make(map[string]interface{})}
+	take := func(keys ...string) string {
+		for _, k := range keys {
+			if v, ok := raw[k].(string); ok {
+				delete(raw, k)
+				return v
+			}
+		}
+		return ""
+	}
+	if t := take("time", "ts"); t != "" {
+		ev.Time, _ = parseTime(t)
+	}
+	ev.Level = strings.ToLower(take("level", "levelname"))
+	ev.System = take("system", "logger")
+	ev.Event = take("event", "msg")
+	for k, v := range raw {
+		ev.Fields[k] = v
+	}
+	return ev
+}
+
+// LogFilter selects which events a Logger returns. The zero value lets
+// every event through.
+type LogFilter struct {
+	// Systems, if not empty, are the only subsystems to return.
+	Systems []string
+	// Level is the least severe level to return. Events without a level
+	// are always returned.
+	Level string
+}
+
+func (f LogFilter) validate() error {
+	if _, ok := levelRanks[strings.ToLower(f.Level)]; f.Level != "" && !ok {
+		return fmt.Errorf("unknown log level %q", f.Level)
+	}
+	return nil
+}
+
+func (f LogFilter) match(ev *LogEvent) bool {
+	if len(f.Systems) > 0 {
+		found := false
+		for _, sys := range f.Systems {
+			if sys == ev.System {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Level != "" && ev.Level != "" {
+		rank, ok := levelRanks[ev.Level]
+		if ok && rank < levelRanks[strings.ToLower(f.Level)] {
+			return false
+		}
+	}
+	return true
+}
+
+// Logger is used to handle incoming logs from the ipfs node. It reconnects
+// when the stream drops until its context ends or it is closed, unless the
+// daemon cannot stream logs or sends something that is not an event.
 type Logger struct {
-	resp io.ReadCloser
-	dec  *json.Decoder
+	shell  *Shell
+	ctx    context.Context
+	filter LogFilter
+
+	// MaxBackoff caps the wait between reconnection attempts.
+	MaxBackoff time.Duration
+
+	mu     sync.Mutex
+	stream *ResponseStream
+	closed bool
+	err    error
 }
 
 // Next is used to retrieve the next event from the logging system
-func (l Logger) Next() (map[string]interface{}, error) {
-	var out map[string]interface{}
-	return out, l.dec.Decode(&out)
+func (l *Logger) Next() (*LogEvent, error) {
+	for {
+		l.mu.Lock()
+		stream, closed := l.stream, l.closed
+		l.mu.Unlock()
+		if closed {
+			return nil, errLoggerClosed
+		}
+
+		var raw map[string]interface{}
+		if err := stream.Next(&raw); err != nil {
+			if l.shell == nil || permanentLogError(err) {
+				return nil, l.fail(err)
+			}
+			if err := l.reconnect(); err != nil {
+				return nil, l.fail(err)
+			}
+			continue
+		}
+		if ev := newLogEvent(raw); l.filter.match(ev) {
+			return ev, nil
+		}
+	}
+}
+
+// Subscribe streams events on the returned channel until ctx ends or the
+// logger fails; Err then tells why. The logger is closed when the channel
+// is.
+func (l *Logger) Subscribe(ctx context.Context) <-chan *LogEvent {
+	ch := make(chan *LogEvent)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.Close()
+		case <-done:
+		}
+	}()
+	go func() {
+		defer close(ch)
+		defer close(done)
+		defer l.Close()
+		for {
+			ev, err := l.Next()
+			if err != nil {
+				l.mu.Lock()
+				if ctx.Err() != nil {
+					err = ctx.Err()
+				}
+				l.err = err
+				l.mu.Unlock()
+				return
+			}
+			select {
+			case ch <- ev:
+			case <-ctx.Done():
+				l.mu.Lock()
+				l.err = ctx.Err()
+				l.mu.Unlock()
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// Err returns the error that ended a subscription, or that Next failed with
+// for good.
+func (l *Logger) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+func (l *Logger) fail(err error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.err = err
+	return err
+}
+
+// permanentLogError tells the errors reconnecting does not help with: a
+// daemon without the command, or a stream that is not JSON.
+func permanentLogError(err error) bool {
+	switch err.(type) {
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return true
+	}
+	return isCommandNotFound(err)
 }
 
 // Close is used to close our reader
-func (l Logger) Close() error {
-	return l.resp.Close()
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	return l.stream.Close()
+}
+
+func (l *Logger) reconnect() error {
+	backoff := 100 * time.Millisecond
+	for {
+		l.mu.Lock()
+		closed := l.closed
+		l.mu.Unlock()
+		if closed {
+			return errLoggerClosed
+		}
+
+		select {
+		case <-l.ctx.Done():
+			return l.ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		stream, err := l.shell.tailLogs(l.ctx)
+		if err == nil {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.closed {
+				stream.Close()
+				return errLoggerClosed
+			}
+			l.stream.Close()
+			l.stream = stream
+			return nil
+		}
+		if permanentLogError(err) {
+			return err
+		}
+		if backoff *= 2; backoff > l.MaxBackoff {
+			backoff = l.MaxBackoff
+		}
+	}
 }
 
 // GetLogs is used to retrieve a parsable logger object
-func (s *Shell) GetLogs(ctx context.Context) (Logger, error) {
-	resp, err := s.Request("log/tail").Send(ctx)
+func (s *Shell) GetLogs(ctx context.Context) (*Logger, error) {
+	return s.GetFilteredLogs(ctx, LogFilter{})
+}
+
+// GetFilteredLogs is like GetLogs, but only returns the events that pass
+// filter.
+func (s *Shell) GetFilteredLogs(ctx context.Context, filter LogFilter) (*Logger, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	stream, err := s.tailLogs(ctx)
 	if err != nil {
-		return Logger{}, err
+		return nil, err
+	}
+	l := newLogger(stream)
+	l.shell = s
+	l.ctx = ctx
+	l.filter = filter
+	return l, nil
+}
+
+func (s *Shell) tailLogs(ctx context.Context) (*ResponseStream, error) {
+	return s.Request("log/tail").Stream(ctx)
+}
+
+func newLogger(stream *ResponseStream) *Logger {
+	return &Logger{
+		ctx:        context.Background(),
+		MaxBackoff: 30 * time.Second,
+		stream:     stream,
+	}
+}
+
+// logLevels are the levels the daemon's log/level command accepts, which
+// are fewer than the ones events come with.
+var logLevels = []string{"debug", "info", "warning", "error", "critical"}
+
+// LogLevel changes the verbosity of a subsystem of the daemon's log, or of
+// every subsystem if subsystem is "all". The level is one of debug, info,
+// warning, error and critical.
+func (s *Shell) LogLevel(subsystem, level string) error {
+	if subsystem == "" {
+		return errors.New("no log subsystem given")
+	}
+	known := false
+	for _, l := range logLevels {
+		if strings.EqualFold(l, level) {
+			known = true
+			break
+		}
 	}
-	if resp.Error != nil {
-		resp.Output.Close()
-		return Logger{}, resp.Error
+	if !known {
+		return fmt.Errorf("unknown log level %q, want one of %s", level, strings.Join(logLevels, ", "))
 	}
-	return newLogger(resp.Output), nil
+	var out struct {
+		Message string
+	}
+	return s.Request("log/level", subsystem, strings.ToLower(level)).Exec(context.Background(), &out)
 }
 
-func newLogger(resp io.ReadCloser) Logger {
-	return Logger{resp, json.NewDecoder(resp)}
+// LogList returns the subsystems of the daemon's log.
+func (s *Shell) LogList() ([]string, error) {
+	var out struct {
+		Strings []string
+	}
+	if err := s.Request("log/ls").Exec(context.Background(), &out); err != nil {
+		return nil, err
+	}
+	return out.Strings, nil
 }
@@ -2,7 +2,13 @@ package shell
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+	"github.com/xcshuan/go-mefs-api/internal/fakedaemon"
 )
 
 func TestLogger(t *testing.T) {
@@ -24,3 +30,121 @@ func TestLogger(t *testing.T) {
 		t.Fatal("no logs found")
 	}
 }
+
+func TestLoggerFilterAndReconnect(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	conns := 0
+	d.Handle("log/tail", func(w http.ResponseWriter, r *http.Request) {
+		conns++
+		w.Header().Set("Content-Type", "application/json")
+		if conns == 1 {
+			// drop the stream after a few events
+			fmt.Fprintln(w, `{"time":"2019-03-04T05:06:07Z","level":"debug","system":"lfs","event":"noise"}`)
+			fmt.Fprintln(w, `{"time":"2019-03-04T05:06:08Z","level":"info","system":"dht","event":"other"}`)
+			fmt.Fprintln(w, `{"time":"2019-03-04T05:06:09Z","level":"warn","system":"lfs","event":"putObject","bucket":"b0"}`)
+			return
+		}
+		fmt.Fprintln(w, `{"time":"2019-03-04T05:07:00Z","level":"error","system":"lfs","event":"getObject"}`)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger, err := s.GetFilteredLogs(ctx, LogFilter{Systems: []string{"lfs"}, Level: "info"})
+	is.NoErr(err)
+
+	ev, err := logger.Next()
+	is.NoErr(err)
+	is.Equal(ev.Event, "putObject")
+	is.Equal(ev.Level, "warn")
+	is.Equal(ev.Fields["bucket"], "b0")
+	is.True(ev.Time.Equal(time.Date(2019, 3, 4, 5, 6, 9, 0, time.UTC)))
+
+	events := logger.Subscribe(ctx)
+	ev = <-events
+	is.NotNil(ev)
+	is.Equal(ev.Event, "getObject")
+	is.Equal(conns, 2)
+
+	cancel()
+	for range events {
+	}
+	is.Equal(logger.Err(), context.Canceled)
+
+	_, err = s.GetFilteredLogs(ctx, LogFilter{Level: "loud"})
+	is.Err(err)
+}
+
+func TestLoggerPermanentErrors(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	// a daemon that stops knowing the command is not retried
+	conns := 0
+	d.Handle("log/tail", func(w http.ResponseWriter, r *http.Request) {
+		conns++
+		if conns > 1 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"level":"info","system":"lfs","event":"first"}`)
+	})
+	logger, err := s.GetLogs(context.Background())
+	is.NoErr(err)
+	ev, err := logger.Next()
+	is.NoErr(err)
+	is.Equal(ev.Event, "first")
+	_, err = logger.Next()
+	is.True(isCommandNotFound(err))
+	is.Equal(logger.Err(), err)
+	is.Equal(conns, 2)
+	logger.Close()
+
+	// nor is one that sends garbage
+	conns = 0
+	d.Handle("log/tail", func(w http.ResponseWriter, r *http.Request) {
+		conns++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `<html>`)
+	})
+	logger, err = s.GetLogs(context.Background())
+	is.NoErr(err)
+	for range logger.Subscribe(context.Background()) {
+	}
+	is.Err(logger.Err())
+	is.Equal(conns, 1)
+}
+
+func TestLogLevel(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	d.Handle("log/level", func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.URL.Query()["arg"], []string{"lfs", "debug"})
+		fakedaemon.JSON(w, map[string]string{"Message": "Changed log level of 'lfs' to 'debug'"})
+	})
+	d.Handle("log/ls", func(w http.ResponseWriter, r *http.Request) {
+		fakedaemon.JSON(w, map[string][]string{"Strings": {"dht", "lfs"}})
+	})
+
+	is.NoErr(s.LogLevel("lfs", "DEBUG"))
+	is.Err(s.LogLevel("lfs", "loud"))
+	// levels events come with that the daemon cannot be set to
+	for _, level := range []string{"notice", "warn", "dpanic", "fatal"} {
+		is.Err(s.LogLevel("lfs", level))
+	}
+	is.Equal(countCalls(d, "log/level"), 1)
+	subs, err := s.LogList()
+	is.NoErr(err)
+	is.Equal(subs, []string{"dht", "lfs"})
+}
@@ -56,7 +56,7 @@ func (s *Shell) TestLocalinfo() {
 }
 
 //keeper计算时空值命令，用于测试，返回计算好的时空值
-func (s *Shell) ResultSummary() int {
+func (s *Shell) ResultSummary() int64 {
 	var il IntList
 	rb := s.Request("test/resultsummary")
 	rb.Exec(context.Background(), &il)
@@ -72,7 +72,7 @@ func (s *Shell) putRandomObject(size int64) {
 	data := make([]byte, size)
 	fillRandom(data)
 	buf := bytes.NewBuffer(data)
-	objectName := "test_" + strconv.Itoa(int(size))
+	objectName := "test_" + strconv.FormatInt(size, 10)
 	_, err := s.PutObject(buf, objectName, TESTBUCKET)
 	if err != nil {
 		fmt.Println("PutObject err!", err)
@@ -0,0 +1,159 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// NodeRole is the part a node plays in mefs.
+type NodeRole string
+
+const (
+	RoleUser     NodeRole = "user"
+	RoleKeeper   NodeRole = "keeper"
+	RoleProvider NodeRole = "provider"
+)
+
+// UnmarshalText accepts roles in any case, as older daemons capitalize them.
+// A role it does not know is kept as the daemon wrote it.
+func (r *NodeRole) UnmarshalText(b []byte) error {
+	role := NodeRole(strings.ToLower(string(b)))
+	switch role {
+	case RoleUser, RoleKeeper, RoleProvider:
+		*r = role
+	default:
+		*r = NodeRole(b)
+	}
+	return nil
+}
+
+// NodeInfo describes a user, keeper or provider node.
+type NodeInfo struct {
+	ID       string
+	Role     NodeRole
+	Online   bool
+	Capacity int64
+	Used     int64
+	Addrs    []string
+}
+
+// Free returns how much of the node's capacity is unused.
+func (ni NodeInfo) Free() int64 {
+	if ni.Used >= ni.Capacity {
+		return 0
+	}
+	return ni.Capacity - ni.Used
+}
+
+func (ni NodeInfo) String() string {
+	return fmt.Sprintf(
+		"ID: %s\n--Role: %s\n--Online: %t\n--Capacity: %d\n--Used: %d\n",
+		ni.ID,
+		ni.Role,
+		ni.Online,
+		ni.Capacity,
+		ni.Used,
+	)
+}
+
+// NodeList is a list of nodes as returned by the daemon.
+type NodeList struct {
+	Nodes []NodeInfo
+}
+
+// Online returns the nodes of the list that are online.
+func (nl NodeList) Online() []NodeInfo {
+	var online []NodeInfo
+	for _, ni := range nl.Nodes {
+		if ni.Online {
+			online = append(online, ni)
+		}
+	}
+	return online
+}
+
+func (nl NodeList) String() string {
+	var str bytes.Buffer
+	for _, ni := range nl.Nodes {
+		str.WriteString(ni.String())
+	}
+	return str.String()
+}
+
+// UserNodes are the keepers and providers serving a user.
+type UserNodes struct {
+	Address   string
+	Keepers   NodeList
+	Providers NodeList
+}
+
+// NodeInfo gets the role, capacity and status of a node.  Arguments:
+//
+// peer: peer.ID of the node to look up.  If no peer is specified,
+//   return information about the local node.
+func (s *Shell) NodeInfo(peer ...string) (*NodeInfo, error) {
+	if len(peer) > 1 {
+		return nil, fmt.Errorf("Too many peer arguments")
+	}
+
+	var out NodeInfo
+	if err := s.Request("node/info", peer...).Exec(context.Background(), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// NodeRole returns the role of the local node.
+func (s *Shell) NodeRole() (NodeRole, error) {
+	info, err := s.NodeInfo()
+	if err != nil {
+		return "", err
+	}
+	return info.Role, nil
+}
+
+// ListKeepers returns the keepers serving a user; pick the user with
+// SetAddress.
+func (s *Shell) ListKeepers(options ...LfsOpts) (*NodeList, error) {
+	return s.listNodes("lfs/list_keepers", options...)
+}
+
+// ListProviders returns the providers storing a user's data; pick the user
+// with SetAddress.
+func (s *Shell) ListProviders(options ...LfsOpts) (*NodeList, error) {
+	return s.listNodes("lfs/list_providers", options...)
+}
+
+// UserNodes returns both the keepers and the providers serving a user.
+func (s *Shell) UserNodes(address string, options ...LfsOpts) (*UserNodes, error) {
+	options = append(options[:len(options):len(options)], SetAddress(address))
+	keepers, err := s.ListKeepers(options...)
+	if err != nil {
+		return nil, err
+	}
+	providers, err := s.ListProviders(options...)
+	if err != nil {
+		return nil, err
+	}
+	return &UserNodes{
+		Address:   address,
+		Keepers:   *keepers,
+		Providers: *providers,
+	}, nil
+}
+
+func (s *Shell) listNodes(command string, options ...LfsOpts) (*NodeList, error) {
+	var nl NodeList
+	rb := s.Request(command)
+	for _, option := range options {
+		if err := option(rb); err != nil {
+			return nil, err
+		}
+	}
+	if err := rb.Exec(context.Background(), &nl); err != nil {
+		return nil, err
+	}
+	return &nl, nil
+}
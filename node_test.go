@@ -0,0 +1,44 @@
+package shell
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/cheekybits/is"
+	"github.com/xcshuan/go-mefs-api/internal/fakedaemon"
+)
+
+func TestNodeInfo(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	d.Handle("node/info", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ID":"QmKeeper","Role":"Keeper","Online":true}`))
+	})
+	role, err := s.NodeRole()
+	is.NoErr(err)
+	is.Equal(role, RoleKeeper)
+
+	d.Handle("lfs/list_keepers", func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.URL.Query().Get("address"), "0xuser")
+		fakedaemon.JSON(w, NodeList{Nodes: []NodeInfo{{ID: "k1", Role: RoleKeeper, Online: true}}})
+	})
+	d.Handle("lfs/list_providers", func(w http.ResponseWriter, r *http.Request) {
+		fakedaemon.JSON(w, NodeList{Nodes: []NodeInfo{
+			{ID: "p1", Role: RoleProvider, Online: true, Capacity: 100, Used: 40},
+			{ID: "p2", Role: RoleProvider, Capacity: 100, Used: 120},
+			{ID: "p3", Role: "Relay"},
+		}})
+	})
+	nodes, err := s.UserNodes("0xuser")
+	is.NoErr(err)
+	is.Equal(nodes.Keepers.Nodes[0].ID, "k1")
+	is.Equal(len(nodes.Providers.Online()), 1)
+	is.Equal(nodes.Providers.Nodes[0].Free(), int64(60))
+	is.Equal(nodes.Providers.Nodes[1].Free(), int64(0))
+	// roles this client does not know do not fail the list
+	is.Equal(nodes.Providers.Nodes[2].Role, NodeRole("Relay"))
+}
@@ -0,0 +1,91 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	files "github.com/ipfs/go-ipfs/source/go-ipfs-files"
+)
+
+// ObjectStats are the sizes of a merkledag object, as returned by
+// ObjectStat.
+type ObjectStats struct {
+	Hash           string
+	BlockSize      int
+	CumulativeSize int
+	DataSize       int
+	LinksSize      int
+	NumLinks       int
+}
+
+// ObjectStat gets stats for the merkledag object with the given key.
+func (s *Shell) ObjectStat(key string) (*ObjectStats, error) {
+	var stat ObjectStats
+	if err := s.Request("object/stat", key).Exec(context.Background(), &stat); err != nil {
+		return nil, err
+	}
+	return &stat, nil
+}
+
+// NewObject creates a new object from a template, such as "unixfs-dir",
+// and returns its hash. An empty template creates an empty object.
+func (s *Shell) NewObject(template string) (string, error) {
+	var out object
+	rb := s.Request("object/new")
+	if template != "" {
+		rb.Arguments(template)
+	}
+	return out.Hash, rb.Exec(context.Background(), &out)
+}
+
+// Patch applies an object patch action, such as "rm-link", to root and
+// returns the hash of the new root.
+func (s *Shell) Patch(root, action string, args ...string) (string, error) {
+	var out object
+	return out.Hash, s.Request("object/patch/"+action, root).
+		Arguments(args...).
+		Exec(context.Background(), &out)
+}
+
+// PatchLink adds a link to childhash under path in root. If create is set,
+// missing intermediate directories are created.
+func (s *Shell) PatchLink(root, path, childhash string, create bool) (string, error) {
+	var out object
+	return out.Hash, s.Request("object/patch/add-link", root, path, childhash).
+		Option("create", create).
+		Exec(context.Background(), &out)
+}
+
+// DagPut stores data, a string, []byte or io.Reader encoded as ienc, as a
+// dag node of format kind and returns its CID.
+func (s *Shell) DagPut(data interface{}, ienc, kind string) (string, error) {
+	var r io.Reader
+	switch data := data.(type) {
+	case string:
+		r = strings.NewReader(data)
+	case []byte:
+		r = bytes.NewReader(data)
+	case io.Reader:
+		r = data
+	default:
+		return "", fmt.Errorf("cannot put values of type %T", data)
+	}
+
+	fr := files.NewReaderFile(r)
+	slf := files.NewSliceDirectory([]files.DirEntry{files.FileEntry("", fr)})
+	fileReader := files.NewMultiFileReader(slf, true)
+
+	var out struct {
+		Cid struct {
+			Target string `json:"/"`
+		}
+	}
+	return out.Cid.Target, s.Request("dag/put").
+		Option("input-enc", ienc).
+		Option("format", kind).
+		Body(fileReader).
+		Exec(context.Background(), &out)
+}
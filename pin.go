@@ -0,0 +1,39 @@
+package shell
+
+import (
+	"context"
+)
+
+const (
+	DirectPin    = "direct"
+	RecursivePin = "recursive"
+	IndirectPin  = "indirect"
+)
+
+type PinInfo struct {
+	Type string
+}
+
+// Pins returns a map of the pin hashes to their info (currently just the
+// pin type, one of DirectPin, RecursivePin, or IndirectPin).
+func (s *Shell) Pins() (map[string]PinInfo, error) {
+	var raw struct{ Keys map[string]PinInfo }
+	if err := s.Request("pin/ls").Exec(context.Background(), &raw); err != nil {
+		return nil, err
+	}
+	return raw.Keys, nil
+}
+
+// Pin the given path recursively.
+func (s *Shell) Pin(path string) error {
+	return s.Request("pin/add", path).
+		Option("recursive", true).
+		Exec(context.Background(), nil)
+}
+
+// Unpin the given path recursively.
+func (s *Shell) Unpin(path string) error {
+	return s.Request("pin/rm", path).
+		Option("recursive", true).
+		Exec(context.Background(), nil)
+}
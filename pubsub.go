@@ -0,0 +1,65 @@
+package shell
+
+import (
+	"context"
+
+	mh "github.com/ipfs/go-ipfs/source/go-multihash"
+)
+
+// PubSubRecord is a message received on a pubsub topic.
+type PubSubRecord struct {
+	From     string
+	Data     string
+	Seqno    []byte
+	TopicIDs []string
+}
+
+// PubSubSubscription allow you to receive pubsub records that where
+// published on the network.
+type PubSubSubscription struct {
+	stream *ResponseStream
+}
+
+// PubSubSubscribe subscribes to a topic.
+func (s *Shell) PubSubSubscribe(topic string) (*PubSubSubscription, error) {
+	stream, err := s.Request("pubsub/sub", topic).Stream(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &PubSubSubscription{stream: stream}, nil
+}
+
+// PubSubPublish publishes data on a topic.
+func (s *Shell) PubSubPublish(topic, data string) error {
+	return s.Request("pubsub/pub", topic, data).Exec(context.Background(), nil)
+}
+
+// Next waits for the next record and returns that.
+func (sub *PubSubSubscription) Next() (*PubSubRecord, error) {
+	for {
+		var raw struct {
+			From     []byte `json:"from"`
+			Data     []byte `json:"data"`
+			Seqno    []byte `json:"seqno"`
+			TopicIDs []string
+		}
+		if err := sub.stream.Next(&raw); err != nil {
+			return nil, err
+		}
+		// the daemon sends an empty record when subscribing
+		if raw.From == nil && raw.Data == nil {
+			continue
+		}
+		return &PubSubRecord{
+			From:     mh.Multihash(raw.From).B58String(),
+			Data:     string(raw.Data),
+			Seqno:    raw.Seqno,
+			TopicIDs: raw.TopicIDs,
+		}, nil
+	}
+}
+
+// Cancel cancels the given subscription.
+func (sub *PubSubSubscription) Cancel() error {
+	return sub.stream.Close()
+}
@@ -0,0 +1,225 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limits caps the traffic a Shell sends to the daemon. Zero means
+// unlimited.
+type Limits struct {
+	// RequestsPerSecond is the rate at which requests may be sent.
+	RequestsPerSecond float64
+	// UploadBytesPerSecond caps request bodies, such as PutObject data.
+	UploadBytesPerSecond int64
+	// DownloadBytesPerSecond caps response bodies, such as GetObject data.
+	DownloadBytesPerSecond int64
+}
+
+func (l Limits) validate() error {
+	if l.RequestsPerSecond < 0 || l.UploadBytesPerSecond < 0 || l.DownloadBytesPerSecond < 0 {
+		return fmt.Errorf("invalid limits %+v: must not be negative", l)
+	}
+	return nil
+}
+
+// SetLimits sets the limits shared by all the requests of the Shell.
+func (s *Shell) SetLimits(l Limits) error {
+	if err := l.validate(); err != nil {
+		return err
+	}
+	s.limitMu.Lock()
+	defer s.limitMu.Unlock()
+	s.limiter = newLimiter(l)
+	return nil
+}
+
+// SetUserLimits sets limits for the requests made for one user, that is
+// with SetAddress(address). They apply on top of the Shell's limits. Zero
+// Limits remove them.
+func (s *Shell) SetUserLimits(address string, l Limits) error {
+	if err := l.validate(); err != nil {
+		return err
+	}
+	s.limitMu.Lock()
+	defer s.limitMu.Unlock()
+	if l == (Limits{}) {
+		delete(s.userLimiters, address)
+		return nil
+	}
+	if s.userLimiters == nil {
+		s.userLimiters = make(map[string]*limiter)
+	}
+	s.userLimiters[address] = newLimiter(l)
+	return nil
+}
+
+// limitersFor returns the limiters that apply to a request for address.
+func (s *Shell) limitersFor(address string) []*limiter {
+	s.limitMu.RLock()
+	defer s.limitMu.RUnlock()
+	var ls []*limiter
+	if s.limiter != nil {
+		ls = append(ls, s.limiter)
+	}
+	if l, ok := s.userLimiters[address]; ok && address != "" {
+		ls = append(ls, l)
+	}
+	return ls
+}
+
+// limiter holds the token buckets of a Limits; nil buckets are unlimited.
+type limiter struct {
+	requests *tokenBucket
+	upload   *tokenBucket
+	download *tokenBucket
+}
+
+func newLimiter(l Limits) *limiter {
+	if l == (Limits{}) {
+		return nil
+	}
+	return &limiter{
+		requests: newTokenBucket(l.RequestsPerSecond),
+		upload:   newTokenBucket(float64(l.UploadBytesPerSecond)),
+		download: newTokenBucket(float64(l.DownloadBytesPerSecond)),
+	}
+}
+
+// tokenBucket hands out rate tokens per second and holds at most a
+// second's worth, or one token, whichever is more.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	burst := math.Max(rate, 1)
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// wait takes n tokens, waiting until they are available or ctx ends. Taking
+// more tokens than the bucket holds is allowed; the wait is just longer.
+func (b *tokenBucket) wait(ctx context.Context, n float64) error {
+	if b == nil || n <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= n
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+	if delay == 0 {
+		return nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		// give back what we did not use
+		b.mu.Lock()
+		b.tokens += n
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// maxLimitedRead bounds a single read of a limited reader so that large
+// buffers are paced rather than waited for all at once.
+const maxLimitedRead = 32 << 10
+
+// limitedReader paces the bytes read through it with buckets.
+type limitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	buckets []*tokenBucket
+	chunk   int
+}
+
+func newLimitedReader(ctx context.Context, r io.Reader, buckets []*tokenBucket) *limitedReader {
+	chunk := maxLimitedRead
+	for _, b := range buckets {
+		if int(b.burst) < chunk {
+			chunk = int(b.burst)
+		}
+	}
+	return &limitedReader{ctx: ctx, r: r, buckets: buckets, chunk: chunk}
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > lr.chunk {
+		p = p[:lr.chunk]
+	}
+	n, err := lr.r.Read(p)
+	for _, b := range lr.buckets {
+		if werr := b.wait(lr.ctx, float64(n)); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+type limitedReadCloser struct {
+	*limitedReader
+	io.Closer
+}
+
+// limitRequest waits for a request token from each of limiters.
+func limitRequest(ctx context.Context, limiters []*limiter) error {
+	for _, l := range limiters {
+		if err := l.requests.wait(ctx, 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func limitUpload(ctx context.Context, body io.Reader, limiters []*limiter) io.Reader {
+	var buckets []*tokenBucket
+	for _, l := range limiters {
+		if l.upload != nil {
+			buckets = append(buckets, l.upload)
+		}
+	}
+	if body == nil || len(buckets) == 0 {
+		return body
+	}
+	return newLimitedReader(ctx, body, buckets)
+}
+
+func limitDownload(ctx context.Context, output io.ReadCloser, limiters []*limiter) io.ReadCloser {
+	var buckets []*tokenBucket
+	for _, l := range limiters {
+		if l.download != nil {
+			buckets = append(buckets, l.download)
+		}
+	}
+	if output == nil || len(buckets) == 0 {
+		return output
+	}
+	return limitedReadCloser{newLimitedReader(ctx, output, buckets), output}
+}
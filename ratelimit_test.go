@@ -0,0 +1,90 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+)
+
+func TestTokenBucket(t *testing.T) {
+	is := is.New(t)
+
+	b := newTokenBucket(100)
+	start := time.Now()
+	// the first second's worth is free
+	is.NoErr(b.wait(context.Background(), 100))
+	is.True(time.Since(start) < 50*time.Millisecond)
+	is.NoErr(b.wait(context.Background(), 20))
+	is.True(time.Since(start) >= 150*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	is.Equal(b.wait(ctx, 1000), context.DeadlineExceeded)
+
+	var unlimited *tokenBucket
+	is.NoErr(unlimited.wait(context.Background(), 1e9))
+}
+
+func TestRequestLimits(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	_, err := s.CreateBucket("b0")
+	is.NoErr(err)
+
+	is.Err(s.SetUserLimits("slow", Limits{RequestsPerSecond: -1}))
+	is.NoErr(s.SetUserLimits("slow", Limits{RequestsPerSecond: 10}))
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		_, err := s.HeadBucket("b0", SetAddress("fast"))
+		is.NoErr(err)
+	}
+	is.True(time.Since(start) < 500*time.Millisecond)
+
+	start = time.Now()
+	for i := 0; i < 15; i++ {
+		_, err := s.HeadBucket("b0", SetAddress("slow"))
+		is.NoErr(err)
+	}
+	is.True(time.Since(start) >= 400*time.Millisecond)
+
+	is.NoErr(s.SetUserLimits("slow", Limits{}))
+	is.Equal(len(s.limitersFor("slow")), 0)
+}
+
+func TestBandwidthLimits(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	_, err := s.CreateBucket("b0")
+	is.NoErr(err)
+	data := bytes.Repeat([]byte("x"), 75<<10)
+
+	is.NoErr(s.SetLimits(Limits{UploadBytesPerSecond: 50 << 10}))
+	start := time.Now()
+	_, err = s.PutObject(bytes.NewReader(data), "a", "b0")
+	is.NoErr(err)
+	is.True(time.Since(start) >= 400*time.Millisecond)
+	stored, ok := d.Object("b0", "a")
+	is.True(ok)
+	is.Equal(stored, data)
+
+	is.NoErr(s.SetLimits(Limits{DownloadBytesPerSecond: 50 << 10}))
+	start = time.Now()
+	r, err := s.GetObject("a", "b0")
+	is.NoErr(err)
+	got, err := ioutil.ReadAll(r)
+	is.NoErr(err)
+	is.NoErr(r.Close())
+	is.True(time.Since(start) >= 400*time.Millisecond)
+	is.Equal(got, data)
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"reflect"
 	"strings"
 
 	files "github.com/ipfs/go-ipfs/source/go-ipfs-files"
@@ -23,6 +24,8 @@ type Request struct {
 	Opts    map[string]string
 	Body    io.Reader
 	Headers map[string]string
+	// Codec sets the encoding option and decodes the response.
+	Codec Codec
 }
 
 func NewRequest(ctx context.Context, url, command string, args ...string) *Request {
@@ -41,6 +44,7 @@ func NewRequest(ctx context.Context, url, command string, args ...string) *Reque
 		Args:    args,
 		Opts:    opts,
 		Headers: make(map[string]string),
+		Codec:   JSONCodec,
 	}
 }
 
@@ -65,6 +69,15 @@ func (r *trailerReader) Close() error {
 type Response struct {
 	Output io.ReadCloser
 	Error  *Error
+
+	codec Codec
+}
+
+func (r *Response) newDecoder() Decoder {
+	if r.codec == nil {
+		return JSONCodec.NewDecoder(r.Output)
+	}
+	return r.codec.NewDecoder(r.Output)
 }
 
 func (r *Response) Close() error {
@@ -88,7 +101,75 @@ func (r *Response) Decode(dec interface{}) error {
 		return r.Error
 	}
 
-	return json.NewDecoder(r.Output).Decode(dec)
+	return r.newDecoder().Decode(dec)
+}
+
+// ErrStopStream can be returned by the function given to DecodeStream to
+// stop reading a stream early without failing.
+var ErrStopStream = errors.New("stop stream")
+
+// ResponseStream reads the JSON values of a streamed response one at a
+// time.
+type ResponseStream struct {
+	output io.ReadCloser
+	dec    Decoder
+}
+
+// Stream returns an iterator over the JSON values of the response. Closing
+// the stream closes the response.
+func (r *Response) Stream() (*ResponseStream, error) {
+	if r.Error != nil {
+		r.Close()
+		return nil, r.Error
+	}
+	return &ResponseStream{
+		output: r.Output,
+		dec:    r.newDecoder(),
+	}, nil
+}
+
+// Next decodes the next value of the stream into v. It returns io.EOF after
+// the last one.
+func (s *ResponseStream) Next(v interface{}) error {
+	return s.dec.Decode(v)
+}
+
+// Close closes the response without reading the rest of it, so it can be
+// used on streams that never end.
+func (s *ResponseStream) Close() error {
+	return s.output.Close()
+}
+
+// DecodeStream decodes the JSON values of the response one after the other
+// into v, which must be a non-nil pointer, and calls fn after each. v is
+// zeroed before each value. It stops at the first error fn returns and
+// returns it, unless it is ErrStopStream.
+func (r *Response) DecodeStream(v interface{}, fn func() error) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		r.Close()
+		return fmt.Errorf("DecodeStream needs a non-nil pointer, not %T", v)
+	}
+	stream, err := r.Stream()
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	elem := rv.Elem()
+	for {
+		elem.Set(reflect.Zero(elem.Type()))
+		if err := stream.Next(v); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(); err == ErrStopStream {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
 }
 
 type Error struct {
@@ -136,7 +217,7 @@ func (r *Request) Send(c *http.Client) (*Response, error) {
 	parts := strings.Split(contentType, ";")
 	contentType = parts[0]
 
-	nresp := new(Response)
+	nresp := &Response{codec: r.Codec}
 
 	nresp.Output = &trailerReader{resp}
 	if resp.StatusCode >= http.StatusBadRequest {
@@ -156,6 +237,10 @@ func (r *Request) Send(c *http.Client) (*Response, error) {
 			if err = json.NewDecoder(resp.Body).Decode(e); err != nil {
 				fmt.Fprintf(os.Stderr, "ipfs-shell: warning! response (%d) unmarshall error: %s\n", resp.StatusCode, err)
 			}
+		case r.Codec != nil && contentType == r.Codec.ContentType():
+			if err = r.Codec.NewDecoder(resp.Body).Decode(e); err != nil {
+				fmt.Fprintf(os.Stderr, "ipfs-shell: warning! response (%d) unmarshall error: %s\n", resp.StatusCode, err)
+			}
 		default:
 			fmt.Fprintf(os.Stderr, "ipfs-shell: warning! unhandled response (%d) encoding: %s", resp.StatusCode, contentType)
 			out, err := ioutil.ReadAll(resp.Body)
@@ -184,6 +269,16 @@ func (r *Request) getURL() string {
 	for k, v := range r.Opts {
 		values.Add(k, v)
 	}
+	if r.Codec != nil {
+		values.Set("encoding", r.Codec.Name())
+	}
 
 	return fmt.Sprintf("%s/%s?%s", r.ApiBase, r.Command, values.Encode())
 }
+
+// isCommandNotFound reports whether err is the daemon telling us it does not
+// know the command, e.g. because it predates it.
+func isCommandNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Message == "command not found"
+}
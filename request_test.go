@@ -0,0 +1,86 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/cheekybits/is"
+	"github.com/xcshuan/go-mefs-api/internal/fakedaemon"
+)
+
+func TestDecodeStream(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	d.Handle("stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"Name":"a","Tags":["x"]}`)
+		fmt.Fprintln(w, `{"Name":"b"}`)
+		fmt.Fprintln(w, `{"Name":"c"}`)
+	})
+
+	type record struct {
+		Name string
+		Tags []string
+	}
+	var rec record
+	var got []record
+	err := s.Request("stream").DecodeStream(context.Background(), &rec, func() error {
+		got = append(got, rec)
+		return nil
+	})
+	is.NoErr(err)
+	// each value is decoded into a zeroed record
+	is.Equal(got, []record{{Name: "a", Tags: []string{"x"}}, {Name: "b"}, {Name: "c"}})
+
+	got = nil
+	err = s.Request("stream").DecodeStream(context.Background(), &rec, func() error {
+		got = append(got, rec)
+		if len(got) == 2 {
+			return ErrStopStream
+		}
+		return nil
+	})
+	is.NoErr(err)
+	is.Equal(len(got), 2)
+
+	failed := errors.New("failed")
+	err = s.Request("stream").DecodeStream(context.Background(), &rec, func() error {
+		return failed
+	})
+	is.Equal(err, failed)
+
+	err = s.Request("stream").DecodeStream(context.Background(), rec, func() error { return nil })
+	is.Err(err)
+
+	d.Handle("stream", func(w http.ResponseWriter, r *http.Request) {
+		fakedaemon.Error(w, "no stream")
+	})
+	_, err = s.Request("stream").Stream(context.Background())
+	is.Err(err)
+	is.Equal(err.(*Error).Message, "no stream")
+}
+
+func TestListStream(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	d.Handle("ls", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"Objects":[{"Hash":"QmDir","Links":[{"Name":"a","Hash":"QmA","Size":1,"Type":2}]}]}`)
+		fmt.Fprintln(w, `{"Objects":[{"Hash":"QmDir","Links":[{"Name":"b","Hash":"QmB","Size":2,"Type":1}]}]}`)
+	})
+
+	links, err := s.List("/ipfs/QmDir")
+	is.NoErr(err)
+	is.Equal(len(links), 2)
+	is.Equal(*links[0], LsLink{Name: "a", Hash: "QmA", Size: 1, Type: TFile})
+	is.Equal(*links[1], LsLink{Name: "b", Hash: "QmB", Size: 2, Type: TDirectory})
+}
@@ -7,6 +7,8 @@ import (
 	"io"
 	"strconv"
 	"strings"
+
+	files "github.com/ipfs/go-ipfs/source/go-ipfs-files"
 )
 
 // RequestBuilder is an IPFS commands request builder.
@@ -16,6 +18,11 @@ type RequestBuilder struct {
 	opts    map[string]string
 	headers map[string]string
 	body    io.Reader
+	codec   Codec
+
+	// lfs holds LfsOpts settings that are applied by the client rather
+	// than sent to the daemon.
+	lfs lfsOptions
 
 	shell *Shell
 }
@@ -63,6 +70,12 @@ func (r *RequestBuilder) Option(key string, value interface{}) *RequestBuilder {
 	return r
 }
 
+// Codec sets the codec of the request, overriding the Shell's.
+func (r *RequestBuilder) Codec(codec Codec) *RequestBuilder {
+	r.codec = codec
+	return r
+}
+
 // Header sets the given header.
 func (r *RequestBuilder) Header(name, value string) *RequestBuilder {
 	if r.headers == nil {
@@ -74,11 +87,50 @@ func (r *RequestBuilder) Header(name, value string) *RequestBuilder {
 
 // Send sends the request and return the response.
 func (r *RequestBuilder) Send(ctx context.Context) (*Response, error) {
+	limiters := r.shell.limitersFor(r.opts["address"])
+	if err := limitRequest(ctx, limiters); err != nil {
+		return nil, err
+	}
+
 	req := NewRequest(ctx, r.shell.url, r.command, r.args...)
-	req.Opts = r.opts
-	req.Headers = r.headers
-	req.Body = r.body
-	return req.Send(&r.shell.httpcli)
+	for k, v := range r.opts {
+		req.Opts[k] = v
+	}
+	for k, v := range r.headers {
+		req.Headers[k] = v
+	}
+	if fr, ok := r.body.(*files.MultiFileReader); ok {
+		// the body is wrapped below, so Request.Send can not tell
+		req.Headers["Content-Type"] = "multipart/form-data; boundary=" + fr.Boundary()
+		req.Headers["Content-Disposition"] = "form-data; name=\"files\""
+	}
+	req.Body = limitUpload(ctx, r.body, limiters)
+	// only a request without a body can be sent again, so only it takes the
+	// Shell's codec, falling back to JSON when the daemon rejects it
+	var fallback Codec
+	switch {
+	case r.codec != nil:
+		req.Codec = r.codec
+	case r.body == nil:
+		if codec := r.shell.codecFor(r.command); codec != nil && codec != JSONCodec {
+			req.Codec = codec
+			fallback = codec
+		}
+	}
+
+	resp, err := req.Send(&r.shell.httpcli)
+	if err != nil {
+		return nil, err
+	}
+	if fallback != nil && isCodecRejected(resp.Error) {
+		r.shell.rejectCodec(r.command, fallback)
+		req.Codec = JSONCodec
+		if resp, err = req.Send(&r.shell.httpcli); err != nil {
+			return nil, err
+		}
+	}
+	resp.Output = limitDownload(ctx, resp.Output, limiters)
+	return resp, nil
 }
 
 // Exec sends the request a request and decodes the response.
@@ -98,3 +150,23 @@ func (r *RequestBuilder) Exec(ctx context.Context, res interface{}) error {
 
 	return httpRes.Decode(res)
 }
+
+// Stream sends the request and returns an iterator over the JSON values of
+// the response.
+func (r *RequestBuilder) Stream(ctx context.Context) (*ResponseStream, error) {
+	httpRes, err := r.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return httpRes.Stream()
+}
+
+// DecodeStream sends the request and decodes every JSON value of the
+// response into v, calling fn after each; see Response.DecodeStream.
+func (r *RequestBuilder) DecodeStream(ctx context.Context, v interface{}, fn func() error) error {
+	httpRes, err := r.Send(ctx)
+	if err != nil {
+		return err
+	}
+	return httpRes.DecodeStream(v, fn)
+}
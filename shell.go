@@ -3,17 +3,16 @@ package shell
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	gohttp "net/http"
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	homedir "github.com/ipfs/go-ipfs/source/go-homedir"
-	files "github.com/ipfs/go-ipfs/source/go-ipfs-files"
 	ma "github.com/ipfs/go-ipfs/source/go-multiaddr"
 	manet "github.com/ipfs/go-ipfs/source/go-multiaddr-net"
 )
@@ -28,6 +27,20 @@ const (
 type Shell struct {
 	url     string
 	httpcli gohttp.Client
+
+	codecMu  sync.RWMutex
+	codec    Codec
+	jsonOnly map[string]bool
+
+	limitMu      sync.RWMutex
+	limiter      *limiter
+	userLimiters map[string]*limiter
+
+	metaMu    sync.RWMutex
+	metaCache *metaCache
+
+	contentMu    sync.RWMutex
+	contentCache *contentCache
 }
 
 func NewLocalShell() *Shell {
@@ -119,29 +132,6 @@ func (s *Shell) ID(peer ...string) (*IdOutput, error) {
 	return &out, nil
 }
 
-const (
-	DirectPin    = "direct"
-	RecursivePin = "recursive"
-	IndirectPin  = "indirect"
-)
-
-type PeerInfo struct {
-	Addrs []string
-	ID    string
-}
-
-func (s *Shell) FindPeer(peer string) (*PeerInfo, error) {
-	var peers struct{ Responses []PeerInfo }
-	err := s.Request("dht/findpeer", peer).Exec(context.Background(), &peers)
-	if err != nil {
-		return nil, err
-	}
-	if len(peers.Responses) == 0 {
-		return nil, errors.New("peer not found")
-	}
-	return &peers.Responses[0], nil
-}
-
 func (s *Shell) ResolvePath(path string) (string, error) {
 	var out struct {
 		Path string
@@ -171,82 +161,3 @@ func (s *Shell) IsUp() bool {
 	_, _, err := s.Version()
 	return err == nil
 }
-
-func (s *Shell) BlockStat(path string) (string, int, error) {
-	var inf struct {
-		Key  string
-		Size int
-	}
-
-	if err := s.Request("block/stat", path).Exec(context.Background(), &inf); err != nil {
-		return "", 0, err
-	}
-	return inf.Key, inf.Size, nil
-}
-
-func (s *Shell) BlockGet(path string) ([]byte, error) {
-	resp, err := s.Request("block/get", path).Send(context.Background())
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Close()
-
-	if resp.Error != nil {
-		return nil, resp.Error
-	}
-
-	return ioutil.ReadAll(resp.Output)
-}
-
-func (s *Shell) BlockPut(block []byte, format, mhtype string, mhlen int) (string, error) {
-	var out struct {
-		Key string
-	}
-
-	fr := files.NewBytesFile(block)
-	slf := files.NewSliceDirectory([]files.DirEntry{files.FileEntry("", fr)})
-	fileReader := files.NewMultiFileReader(slf, true)
-
-	return out.Key, s.Request("block/put").
-		Option("mhtype", mhtype).
-		Option("format", format).
-		Option("mhlen", mhlen).
-		Body(fileReader).
-		Exec(context.Background(), &out)
-}
-
-type SwarmStreamInfo struct {
-	Protocol string
-}
-
-type SwarmConnInfo struct {
-	Addr    string
-	Peer    string
-	Latency string
-	Muxer   string
-	Streams []SwarmStreamInfo
-}
-
-type SwarmConnInfos struct {
-	Peers []SwarmConnInfo
-}
-
-// SwarmPeers gets all the swarm peers
-func (s *Shell) SwarmPeers(ctx context.Context) (*SwarmConnInfos, error) {
-	v := &SwarmConnInfos{}
-	err := s.Request("swarm/peers").Exec(ctx, &v)
-	return v, err
-}
-
-type swarmConnection struct {
-	Strings []string
-}
-
-// SwarmConnect opens a swarm connection to a specific address.
-func (s *Shell) SwarmConnect(ctx context.Context, addr ...string) error {
-	var conn *swarmConnection
-	err := s.Request("swarm/connect").
-		Arguments(addr...).
-		Exec(ctx, &conn)
-	return err
-}
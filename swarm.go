@@ -0,0 +1,277 @@
+package shell
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	ma "github.com/ipfs/go-ipfs/source/go-multiaddr"
+)
+
+type SwarmStreamInfo struct {
+	Protocol string
+}
+
+type SwarmConnInfo struct {
+	// Addr is nil if the client cannot parse the address, e.g. of a relayed
+	// connection; RawAddr always holds it as the daemon sent it.
+	Addr    ma.Multiaddr
+	RawAddr string
+	Peer    string
+	Latency time.Duration
+	Muxer   string
+	Streams []SwarmStreamInfo
+}
+
+// UnmarshalJSON parses the address and latency the daemon sends as strings.
+// A latency the daemon has not measured yet ("n/a") or that cannot be parsed
+// is left at zero, and an address the client does not know the protocols of
+// is only kept in RawAddr.
+func (ci *SwarmConnInfo) UnmarshalJSON(b []byte) error {
+	var raw rawSwarmConn
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	ci.set(raw)
+	return nil
+}
+
+func (ci *SwarmConnInfo) unmarshalCBOR(d *cborDecoder) error {
+	var raw rawSwarmConn
+	if err := d.into(&raw); err != nil {
+		return err
+	}
+	ci.set(raw)
+	return nil
+}
+
+// rawSwarmConn is a connection as the daemon sends it.
+type rawSwarmConn struct {
+	Addr    string
+	Peer    string
+	Latency string
+	Muxer   string
+	Streams []SwarmStreamInfo
+}
+
+func (ci *SwarmConnInfo) set(raw rawSwarmConn) {
+	*ci = SwarmConnInfo{
+		RawAddr: raw.Addr,
+		Peer:    raw.Peer,
+		Muxer:   raw.Muxer,
+		Streams: raw.Streams,
+	}
+	if raw.Addr != "" {
+		ci.Addr, _ = ma.NewMultiaddr(raw.Addr)
+	}
+	if raw.Latency != "" && raw.Latency != "n/a" {
+		ci.Latency, _ = time.ParseDuration(raw.Latency)
+	}
+}
+
+type SwarmConnInfos struct {
+	Peers []SwarmConnInfo
+}
+
+// SwarmPeers gets all the swarm peers
+func (s *Shell) SwarmPeers(ctx context.Context) (*SwarmConnInfos, error) {
+	v := &SwarmConnInfos{}
+	var out SwarmConnInfos
+	err := s.Request("swarm/peers").DecodeStream(ctx, &out, func() error {
+		v.Peers = append(v.Peers, out.Peers...)
+		return nil
+	})
+	return v, err
+}
+
+type swarmConnection struct {
+	Strings []string
+}
+
+// SwarmConnect opens a swarm connection to a specific address.
+func (s *Shell) SwarmConnect(ctx context.Context, addr ...string) error {
+	var conn *swarmConnection
+	err := s.Request("swarm/connect").
+		Arguments(addr...).
+		Exec(ctx, &conn)
+	return err
+}
+
+// SwarmDisconnect closes the swarm connections to the given addresses.
+func (s *Shell) SwarmDisconnect(ctx context.Context, addr ...string) error {
+	var conn *swarmConnection
+	err := s.Request("swarm/disconnect").
+		Arguments(addr...).
+		Exec(ctx, &conn)
+	return err
+}
+
+// SwarmLocalAddrs returns the addresses the local node listens on. Like all
+// swarm calls it leaves out the addresses the client cannot parse.
+func (s *Shell) SwarmLocalAddrs(ctx context.Context) ([]ma.Multiaddr, error) {
+	var out swarmConnection
+	if err := s.Request("swarm/addrs/local").Exec(ctx, &out); err != nil {
+		return nil, err
+	}
+	return parseMultiaddrs(out.Strings), nil
+}
+
+// SwarmAddrs returns the known addresses of every peer, keyed by peer ID,
+// leaving out the addresses the client cannot parse.
+func (s *Shell) SwarmAddrs(ctx context.Context) (map[string][]ma.Multiaddr, error) {
+	var out struct {
+		Addrs map[string][]string
+	}
+	if err := s.Request("swarm/addrs").Exec(ctx, &out); err != nil {
+		return nil, err
+	}
+	addrs := make(map[string][]ma.Multiaddr, len(out.Addrs))
+	for p, strs := range out.Addrs {
+		addrs[p] = parseMultiaddrs(strs)
+	}
+	return addrs, nil
+}
+
+// SwarmFilters returns the address filters of the swarm.
+func (s *Shell) SwarmFilters(ctx context.Context) ([]string, error) {
+	var out swarmConnection
+	if err := s.Request("swarm/filters").Exec(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out.Strings, nil
+}
+
+// SwarmFiltersAdd adds address filters, such as
+// /ip4/192.168.0.0/ipcidr/16, and returns the ones added.
+func (s *Shell) SwarmFiltersAdd(ctx context.Context, filters ...string) ([]string, error) {
+	var out swarmConnection
+	if err := s.Request("swarm/filters/add", filters...).Exec(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out.Strings, nil
+}
+
+// SwarmFiltersRm removes address filters and returns the ones removed.
+func (s *Shell) SwarmFiltersRm(ctx context.Context, filters ...string) ([]string, error) {
+	var out swarmConnection
+	if err := s.Request("swarm/filters/rm", filters...).Exec(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out.Strings, nil
+}
+
+// parseMultiaddrs parses the addresses it can, e.g. not those of transports
+// the client does not know, and skips the others.
+func parseMultiaddrs(strs []string) []ma.Multiaddr {
+	addrs := make([]ma.Multiaddr, 0, len(strs))
+	for _, str := range strs {
+		if a, err := ma.NewMultiaddr(str); err == nil {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+// PeerEventType tells whether a peer came or went.
+type PeerEventType int
+
+const (
+	PeerConnected PeerEventType = iota
+	PeerDisconnected
+)
+
+func (t PeerEventType) String() string {
+	switch t {
+	case PeerConnected:
+		return "connected"
+	case PeerDisconnected:
+		return "disconnected"
+	default:
+		return fmt.Sprintf("PeerEventType(%d)", int(t))
+	}
+}
+
+// PeerEvent is sent by WatchPeers. If Err is set, polling the peers failed
+// and Type and Conn are meaningless; watching goes on regardless.
+type PeerEvent struct {
+	Type PeerEventType
+	// Conn is the connection as last seen.
+	Conn SwarmConnInfo
+	Err  error
+}
+
+// WatchPeers polls the swarm peers every interval and sends an event for
+// each peer that connects or disconnects. The peers connected when it starts
+// are sent as connected. The channel is closed when ctx ends.
+func (s *Shell) WatchPeers(ctx context.Context, interval time.Duration) (<-chan PeerEvent, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid peer watch interval %s", interval)
+	}
+	first, err := s.SwarmPeers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan PeerEvent)
+	go func() {
+		defer close(ch)
+		send := func(ev PeerEvent) bool {
+			select {
+			case ch <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		known := make(map[string]SwarmConnInfo)
+		update := func(infos *SwarmConnInfos) bool {
+			now := make(map[string]SwarmConnInfo, len(infos.Peers))
+			for _, ci := range infos.Peers {
+				if _, ok := now[ci.Peer]; ok {
+					continue
+				}
+				now[ci.Peer] = ci
+				if _, ok := known[ci.Peer]; !ok {
+					if !send(PeerEvent{Type: PeerConnected, Conn: ci}) {
+						return false
+					}
+				}
+			}
+			for p, ci := range known {
+				if _, ok := now[p]; !ok {
+					if !send(PeerEvent{Type: PeerDisconnected, Conn: ci}) {
+						return false
+					}
+				}
+			}
+			known = now
+			return true
+		}
+
+		if !update(first) {
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			infos, err := s.SwarmPeers(ctx)
+			if err != nil {
+				if ctx.Err() != nil || !send(PeerEvent{Err: err}) {
+					return
+				}
+				continue
+			}
+			if !update(infos) {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
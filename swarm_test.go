@@ -0,0 +1,113 @@
+package shell
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+	"github.com/xcshuan/go-mefs-api/internal/fakedaemon"
+)
+
+func fakePeer(id, latency string) map[string]interface{} {
+	return map[string]interface{}{
+		"Addr":    "/ip4/10.0.0.1/tcp/4001",
+		"Peer":    id,
+		"Latency": latency,
+	}
+}
+
+func TestSwarmConnInfo(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	relayed := fakePeer("QmC", "3ms")
+	relayed["Addr"] = "/ip4/10.0.0.2/tcp/4001/unknown-transport"
+	d.Handle("swarm/peers", func(w http.ResponseWriter, r *http.Request) {
+		fakedaemon.JSON(w, map[string]interface{}{
+			"Peers": []interface{}{fakePeer("QmA", "1.5ms"), fakePeer("QmB", "n/a"), relayed},
+		})
+	})
+	infos, err := s.SwarmPeers(context.Background())
+	is.NoErr(err)
+	is.Equal(len(infos.Peers), 3)
+	is.Equal(infos.Peers[0].Latency, 1500*time.Microsecond)
+	is.Equal(infos.Peers[0].Addr.String(), "/ip4/10.0.0.1/tcp/4001")
+	is.Equal(infos.Peers[1].Latency, time.Duration(0))
+	// an address the client cannot parse does not fail the others
+	is.Nil(infos.Peers[2].Addr)
+	is.Equal(infos.Peers[2].RawAddr, "/ip4/10.0.0.2/tcp/4001/unknown-transport")
+
+	d.Handle("swarm/peers", func(w http.ResponseWriter, r *http.Request) {
+		fakedaemon.JSON(w, map[string]interface{}{"Peers": []interface{}{fakePeer("QmD", "soon")}})
+	})
+	infos, err = s.SwarmPeers(context.Background())
+	is.NoErr(err)
+	is.Equal(infos.Peers[0].Latency, time.Duration(0))
+
+	// the other swarm calls skip what they cannot parse too
+	d.Handle("swarm/addrs/local", func(w http.ResponseWriter, r *http.Request) {
+		fakedaemon.JSON(w, swarmConnection{Strings: []string{"/ip4/bogus", "/ip4/127.0.0.1/tcp/4001"}})
+	})
+	local, err := s.SwarmLocalAddrs(context.Background())
+	is.NoErr(err)
+	is.Equal(len(local), 1)
+	is.Equal(local[0].String(), "/ip4/127.0.0.1/tcp/4001")
+
+	d.Handle("swarm/addrs", func(w http.ResponseWriter, r *http.Request) {
+		fakedaemon.JSON(w, map[string]interface{}{"Addrs": map[string][]string{
+			"QmA": {"/ip4/10.0.0.1/tcp/4001", "/ip4/10.0.0.2/tcp/4001/unknown-transport"},
+		}})
+	})
+	addrs, err := s.SwarmAddrs(context.Background())
+	is.NoErr(err)
+	is.Equal(len(addrs["QmA"]), 1)
+}
+
+func TestWatchPeers(t *testing.T) {
+	is := is.New(t)
+	d := newFakeDaemon()
+	defer d.Close()
+	s := d.Shell()
+
+	var mu sync.Mutex
+	peers := []interface{}{fakePeer("QmA", ""), fakePeer("QmB", "")}
+	d.Handle("swarm/peers", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fakedaemon.JSON(w, map[string]interface{}{"Peers": peers})
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := s.WatchPeers(ctx, 10*time.Millisecond)
+	is.NoErr(err)
+
+	seen := map[string]PeerEventType{}
+	for i := 0; i < 2; i++ {
+		ev := <-ch
+		is.NoErr(ev.Err)
+		seen[ev.Conn.Peer] = ev.Type
+	}
+	is.Equal(seen, map[string]PeerEventType{"QmA": PeerConnected, "QmB": PeerConnected})
+
+	mu.Lock()
+	peers = []interface{}{fakePeer("QmB", ""), fakePeer("QmC", "")}
+	mu.Unlock()
+
+	seen = map[string]PeerEventType{}
+	for i := 0; i < 2; i++ {
+		ev := <-ch
+		is.NoErr(ev.Err)
+		seen[ev.Conn.Peer] = ev.Type
+	}
+	is.Equal(seen, map[string]PeerEventType{"QmA": PeerDisconnected, "QmC": PeerConnected})
+
+	cancel()
+	for range ch {
+	}
+}
@@ -0,0 +1,95 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Types of unixfs nodes, as found in LsLink.Type.
+const (
+	TRaw = iota
+	TDirectory
+	TFile
+	TMetadata
+	TSymlink
+)
+
+type LsLink struct {
+	Hash string
+	Name string
+	Size uint64
+	Type int
+}
+
+type LsObject struct {
+	Links []*LsLink
+	LsLink
+}
+
+type UnixLsLink struct {
+	Hash string
+	Name string
+	Size uint64
+	Type string
+}
+
+type UnixLsObject struct {
+	Hash  string
+	Size  uint64
+	Type  string
+	Links []*UnixLsLink
+}
+
+// Cat returns a reader for the data of the file at path.
+func (s *Shell) Cat(path string) (io.ReadCloser, error) {
+	resp, err := s.Request("cat", path).Send(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		resp.Close()
+		return nil, resp.Error
+	}
+	return resp.Output, nil
+}
+
+// List entries at the given path. The daemon may stream the links of a
+// large directory over several records; they are all collected.
+func (s *Shell) List(path string) ([]*LsLink, error) {
+	var out struct{ Objects []LsObject }
+	var links []*LsLink
+	found := false
+	err := s.Request("ls", path).DecodeStream(context.Background(), &out, func() error {
+		for _, ob := range out.Objects {
+			found = true
+			links = append(links, ob.Links...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("bad response from server")
+	}
+	return links, nil
+}
+
+// FileList entries at the given path using the UnixFS commands
+func (s *Shell) FileList(path string) (*UnixLsObject, error) {
+	var out struct {
+		Arguments map[string]string
+		Objects   map[string]*UnixLsObject
+	}
+	if err := s.Request("file/ls", path).Exec(context.Background(), &out); err != nil {
+		return nil, err
+	}
+	if hash, ok := out.Arguments[path]; ok && out.Objects[hash] != nil {
+		return out.Objects[hash], nil
+	}
+	for _, object := range out.Objects {
+		return object, nil
+	}
+	return nil, errors.New("no object in results")
+}